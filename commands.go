@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	conf "github.com/brentahughes/service_tester/pkg/config"
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/export"
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/brentahughes/service_tester/pkg/otlp"
+)
+
+// runCommand runs a subcommand given after the flags instead of the service, e.g. service_tester -db.path .db backup -o db.bak
+func runCommand(c *conf.Config, name string, args []string) error {
+	switch name {
+	case "backup":
+		return backupCommand(c, args)
+	case "restore":
+		return restoreCommand(c, args)
+	case "export":
+		return exportCommand(c, args)
+	case "otlp-receiver":
+		return otlpReceiverCommand(args)
+	default:
+		return fmt.Errorf("unknown command %q, must be backup, restore, export or otlp-receiver", name)
+	}
+}
+
+// otlpReceiverCommand runs a stand-in for an OTLP collector that logs what is pushed to it
+func otlpReceiverCommand(args []string) error {
+	fs := flag.NewFlagSet("otlp-receiver", flag.ExitOnError)
+	addr := fs.String("addr", ":4318", "Address to listen on for OTLP/HTTP JSON pushes")
+	verbose := fs.Bool("v", false, "Log every data point and span")
+	fs.Parse(args)
+
+	log.Printf("otlp receiver listening on %s", *addr)
+	return http.ListenAndServe(*addr, &otlp.Receiver{Verbose: *verbose})
+}
+
+// backupCommand writes a backup of the database to a file or stdout
+func backupCommand(c *conf.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := fs.String("o", "-", "File to write the backup to, - for stdout")
+	fs.Parse(args)
+
+	// The backup is of the data as it is, so it is not migrated first
+	db, err := openReadOnlyStore(c)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	backupable, ok := db.(database.Backupable)
+	if !ok {
+		return fmt.Errorf("the %s backend can't be backed up", c.DBBackend)
+	}
+
+	w, err := createOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err := backupable.Backup(w); err != nil {
+		return err
+	}
+	log.Printf("backed up %s to %s", c.DBPath, *output)
+	return nil
+}
+
+// restoreCommand loads a backup from a file or stdin into an empty db.path
+func restoreCommand(c *conf.Config, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	input := fs.String("i", "-", "File to read the backup from, - for stdin")
+	fs.Parse(args)
+
+	if c.DBBackend != "badger" {
+		return errors.New("only the badger backend can be restored")
+	}
+
+	r := io.ReadCloser(os.Stdin)
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	if err := database.RestoreBadger(c.DBPath, r); err != nil {
+		return err
+	}
+	log.Printf("restored %s into %s", *input, c.DBPath)
+	return nil
+}
+
+// exportCommand writes hosts, checks or rollups as ndjson or csv to a file or stdout
+func exportCommand(c *conf.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "-", "File to write the export to, - for stdout")
+	format := fs.String("format", export.FormatNDJSON, "Format of the export, ndjson or csv")
+	start := fs.String("start", "", "Export checks and rollups from this time (RFC3339)")
+	end := fs.String("end", "", "Export checks and rollups before this time (RFC3339)")
+	resolution := fs.String("resolution", string(models.ResolutionHour), "Resolution of the exported rollups, minute, hour or day")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: service_tester [flags] export [options] hosts|checks|rollups")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts := export.Options{
+		Kind:       fs.Arg(0),
+		Format:     *format,
+		Resolution: models.Resolution(*resolution),
+	}
+	var err error
+	if opts.Start, err = parseOptionalTime(*start); err != nil {
+		return err
+	}
+	if opts.End, err = parseOptionalTime(*end); err != nil {
+		return err
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	db, err := openReadOnlyStore(c)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Records written by older versions can't be read until the service has migrated them
+	if b, ok := db.(*database.Badger); ok {
+		version, err := b.GetSchemaVersion()
+		if err != nil {
+			return err
+		}
+		if version != database.SchemaVersion() {
+			return fmt.Errorf("database schema version %d is not the supported version %d, start the service once to migrate it", version, database.SchemaVersion())
+		}
+	}
+
+	w, err := createOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return export.Write(db, w, opts)
+}
+
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(path)
+}
+
+func parseOptionalTime(str string) (time.Time, error) {
+	if str == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, str)
+}
@@ -173,11 +173,58 @@ function HostDetails(props) {
                         </ButtonGroup>
                     </Col>
                 </Row>
+                <Row>
+                    {Object.keys(props.host.latestChecks)
+                        .filter(network => network !== 'public' && network !== 'internal')
+                        .sort()
+                        .map(network => (
+                            <Col lg={6} className="text-center" key={network}>
+                                {network} {props.host.addresses ? props.host.addresses[network] : ''}
+                                <br />
+                                <NetworkStatus
+                                    latestChecks={props.host.latestChecks[network]}
+                                    uptime={props.host.checkUptime[network]}
+                                />
+                            </Col>
+                        ))}
+                </Row>
+                <br />
+                <Row>
+                    <Col lg={12} className="text-center">
+                        <InboundStats name="TCP" stats={props.host.inbound ? props.host.inbound.tcp : null} />
+                        <InboundStats name="UDP" stats={props.host.inbound ? props.host.inbound.udp : null} />
+                    </Col>
+                </Row>
             </Container>
         </Row>
     );
 }
 
+function NetworkStatus(props) {
+    let status = (checks) => checks ? checks[0].status : "error";
+    let uptime = (type) => props.uptime ? props.uptime[type].percent : 0;
+
+    return (
+        <ButtonGroup>
+            <OverviewHostStatus name='HTTP' status={status(props.latestChecks.http)} uptime={uptime('http')} />
+            <OverviewHostStatus name='ICMP' status={status(props.latestChecks.icmp)} uptime={uptime('icmp')} />
+            <OverviewHostStatus name='TCP' status={status(props.latestChecks.tcp)} uptime={uptime('tcp')} />
+            <OverviewHostStatus name='UDP' status={status(props.latestChecks.udp)} uptime={uptime('udp')} />
+        </ButtonGroup>
+    );
+}
+
+function InboundStats(props) {
+    if (!props.stats || !props.stats.requests) {
+        return <div>Inbound {props.name}: never seen</div>;
+    }
+    return (
+        <div>
+            Inbound {props.name}: {props.stats.requests} requests, {props.stats.bytes} bytes, last seen {moment(props.stats.lastSeenAt).fromNow()}
+        </div>
+    );
+}
+
 function Graph(props) {
     let publicData = [];
     let internalData = [];
@@ -38,6 +38,23 @@ function OverviewBanner(props) {
                         <br />
                     </Col>
                 </Row>
+                <Row>
+                    <Col sm={6} className="text-center">
+                        <b>Reflexive Address</b>
+                        <br />
+                        {props.currentHost.reflexive && props.currentHost.reflexive.publicIp ? props.currentHost.reflexive.publicIp : "unknown"}
+                        <br />
+                        <br />
+                    </Col>
+                    <Col sm={6} className="text-center">
+                        <b>NAT Mapping</b>
+                        <br />
+                        {props.currentHost.reflexive ? props.currentHost.reflexive.natType : "unknown"}
+                        {props.currentHost.reflexive ? " (" + props.currentHost.reflexive.peers + " peers)" : ""}
+                        <br />
+                        <br />
+                    </Col>
+                </Row>
             </Container>
         </Container>
     );
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -8,11 +10,14 @@ import (
 	"time"
 
 	conf "github.com/brentahughes/service_tester/pkg/config"
-	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/metrics"
+	"github.com/brentahughes/service_tester/pkg/otlp"
+	"github.com/brentahughes/service_tester/pkg/rollup"
 	"github.com/brentahughes/service_tester/pkg/service"
 	"github.com/brentahughes/service_tester/pkg/servicecheck"
+	"github.com/brentahughes/service_tester/pkg/stream"
 	"github.com/brentahughes/service_tester/pkg/webserver"
-	"github.com/dgraph-io/badger"
 )
 
 func init() {
@@ -24,26 +29,56 @@ func main() {
 		log.Fatal(err)
 	}
 
-	opts := badger.DefaultOptions(".db").WithSyncWrites(false)
-	db, err := badger.Open(opts)
+	if cmd := flag.Arg(0); cmd != "" {
+		if err := runCommand(c, cmd, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	db, err := openStore(c)
 	if err != nil {
 		log.Fatal("error opening database: ", err)
 	}
 	defer db.Close()
 
+	if c.DBMigrateDryRun {
+		log.Printf("Dry run of database migrations finished")
+		return
+	}
+
+	// Every event of the node is saved and streamed through one log
+	hub := stream.NewHub()
+	events := database.NewEventLog(db, c.EventRetention)
+	events.OnRecord(hub.PublishEvent)
+
 	go keepCurrentHostUpdated(db, c)
+	go reconcileHosts(db, c, events)
 
-	s := service.NewService(c.ServicePort)
+	s := service.NewService(db, c.ServicePort)
 	go s.Start()
 
-	checker, err := servicecheck.NewChecker(db, c)
+	registry := metrics.NewRegistry(c)
+	registry.RegisterStore(db)
+
+	exporter := otlp.NewExporter(c, registry)
+	if exporter != nil {
+		go exporter.Start()
+		defer exporter.Stop()
+	}
+
+	checker, err := servicecheck.NewChecker(db, c, registry, exporter, hub, events)
 	if err != nil {
 		log.Fatal(err)
 	}
 	go checker.Start()
 	defer checker.Stop()
 
-	server := webserver.NewServer(*c, db, c.Port)
+	downsampler := rollup.NewDownsampler(db, c)
+	go downsampler.Start()
+	defer downsampler.Stop()
+
+	server := webserver.NewServer(*c, db, c.Port, registry, hub, events)
 	go func() {
 		if err := server.Start(); err != nil {
 			log.Fatal("error starting web interface", err)
@@ -57,15 +92,66 @@ func main() {
 	log.Printf("Shutdown signal received")
 }
 
-func keepCurrentHostUpdated(db *badger.DB, c *conf.Config) {
-	if err := models.UpdateCurrentHost(db, c, true); err != nil {
+func openStore(c *conf.Config) (database.Store, error) {
+	switch c.DBBackend {
+	case "memory":
+		return database.NewMemory(), nil
+	case "badger":
+		open := database.NewBadger
+		if c.DBMigrateDryRun {
+			// The dry run only plans the migrations, so it opens the database read-only
+			open = database.OpenBadgerReadOnly
+		}
+		db, err := open(c.DBPath)
+		if err != nil {
+			return nil, err
+		}
+
+		// Upgrade the keys and values of databases written by older versions before use
+		if err := db.Migrate(c.DBMigrateDryRun); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown database backend %q", c.DBBackend)
+	}
+}
+
+// openReadOnlyStore opens the database for commands that only read it, without migrating
+func openReadOnlyStore(c *conf.Config) (database.Store, error) {
+	switch c.DBBackend {
+	case "memory":
+		return database.NewMemory(), nil
+	case "badger":
+		return database.OpenBadgerReadOnly(c.DBPath)
+	default:
+		return nil, fmt.Errorf("unknown database backend %q", c.DBBackend)
+	}
+}
+
+func keepCurrentHostUpdated(db database.Store, c *conf.Config) {
+	if err := database.UpdateCurrentHost(db, c, true); err != nil {
 		log.Fatal("Error updating current host: ", err)
 	}
 
 	t := time.NewTicker(time.Hour)
 	for range t.C {
-		if err := models.UpdateCurrentHost(db, c, false); err != nil {
+		if err := database.UpdateCurrentHost(db, c, false); err != nil {
 			log.Println("Error updating current host: ", err)
 		}
 	}
 }
+
+func reconcileHosts(db database.Store, c *conf.Config, events *database.EventLog) {
+	if c.ReconcileEvery <= 0 {
+		return
+	}
+
+	t := time.NewTicker(c.ReconcileEvery)
+	for range t.C {
+		if _, err := database.Reconcile(db, events); err != nil {
+			log.Println("Error reconciling hosts: ", err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package v1 is the request and response types of version 1 of the webserver api that are
+// not models themselves. They are shared by the webserver and the client so both stay in step.
+package v1
+
+import (
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// Version is the version of the api these types describe
+const Version = "v1"
+
+// ErrorResponse is the body of every response with an error status
+type ErrorResponse struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// HealthResponse is the current host with how the requester was observed
+type HealthResponse struct {
+	*models.Host
+	ObservedAddr string                   `json:"observedAddr"`
+	Reflexive    *models.ReflexiveAddress `json:"reflexive"`
+}
+
+// HistoryResponse is the rollups of a host over a time range
+type HistoryResponse struct {
+	Resolution models.Resolution `json:"resolution"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Rollups    []models.Rollup   `json:"rollups"`
+}
+
+// RestartsResponse is the restarts of a peer seen by a node and their timeline
+type RestartsResponse struct {
+	HostID   string `json:"hostId"`
+	Hostname string `json:"hostname"`
+	// ServiceRestarts is the number of restarts the peer reports for itself
+	ServiceRestarts  int                   `json:"serviceRestarts"`
+	ServiceLastStart time.Time             `json:"serviceLastStart"`
+	BootedAt         time.Time             `json:"bootedAt"`
+	Counts           *models.RestartCounts `json:"counts"`
+	Timeline         []models.Event        `json:"timeline"`
+	// Next is the cursor of the next page of the timeline, empty on the last page
+	Next string `json:"next,omitempty"`
+}
+
+// WriterStats describes the queue of writes waiting for the single writer of the database
+type WriterStats struct {
+	QueueDepth        int           `json:"queueDepth"`
+	QueueCapacity     int           `json:"queueCapacity"`
+	Batches           uint64        `json:"batches"`
+	Writes            uint64        `json:"writes"`
+	Conflicts         uint64        `json:"conflicts"`
+	Errors            uint64        `json:"errors"`
+	LastBatchSize     uint64        `json:"lastBatchSize"`
+	LastBatchDuration time.Duration `json:"lastBatchDuration"`
+}
@@ -0,0 +1,118 @@
+// Package client is a Go client of the webserver api of a node, used by the checker to talk
+// to its peers.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	apiv1 "github.com/brentahughes/service_tester/pkg/api/v1"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// Client calls the api of one node
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	adminToken string
+}
+
+// Response is the raw response of a call, returned even when the call failed after the
+// node responded so callers can record the status code and body
+type Response struct {
+	StatusCode int
+	Body       []byte
+}
+
+// Error is a response with an error status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("error bad status response: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("error bad status response: %d: %s", e.StatusCode, e.Message)
+}
+
+// New returns a client of the node at addr, an ip, host:port or a base url. The default
+// http client is used when httpClient is nil.
+func New(addr string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(addr, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// WithAdminToken returns a copy of the client that sends the token of the node's admin api
+func (c *Client) WithAdminToken(token string) *Client {
+	admin := *c
+	admin.adminToken = token
+	return &admin
+}
+
+// get calls the path and decodes the body into v. Hosts stored by versions before ids were
+// strings are upgraded before decoding.
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) (*Response, error) {
+	return c.do(ctx, http.MethodGet, path, query, v)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, v interface{}) (*Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if c.adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	r := &Response{StatusCode: resp.StatusCode, Body: body}
+	if err != nil {
+		return r, err
+	}
+
+	if resp.StatusCode > 399 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		var errResp apiv1.ErrorResponse
+		if json.Unmarshal(body, &errResp) == nil {
+			apiErr.Message = errResp.Message
+		}
+		return r, apiErr
+	}
+
+	if v == nil || len(body) == 0 {
+		return r, nil
+	}
+	return r, json.Unmarshal(models.UpgradeHostJSON(body), v)
+}
+
+func pathEscape(segment string) string {
+	return url.PathEscape(segment)
+}
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	apiv1 "github.com/brentahughes/service_tester/pkg/api/v1"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// Health returns the node's own host and how it observed the request
+func (c *Client) Health(ctx context.Context) (*apiv1.HealthResponse, *Response, error) {
+	var health apiv1.HealthResponse
+	resp, err := c.get(ctx, "/api/health", nil, &health)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &health, resp, nil
+}
+
+// InboundHealth returns the results every peer of the node has against it
+func (c *Client) InboundHealth(ctx context.Context, refresh bool) (*models.MeshMatrix, *Response, error) {
+	var inbound models.MeshMatrix
+	resp, err := c.get(ctx, "/api/health/inbound", refreshQuery(refresh), &inbound)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &inbound, resp, nil
+}
+
+// Hosts returns the hosts the node checks with their latest results, only the hosts with
+// labels matching the selector when it is not empty
+func (c *Client) Hosts(ctx context.Context, selector string) ([]models.Host, *Response, error) {
+	query := url.Values{}
+	if selector != "" {
+		query.Set("selector", selector)
+	}
+
+	var hosts []models.Host
+	resp, err := c.get(ctx, "/api/hosts", query, &hosts)
+	if err != nil {
+		return nil, resp, err
+	}
+	return hosts, resp, nil
+}
+
+// Host returns a host by the id the node knows it by
+func (c *Client) Host(ctx context.Context, id string) (*models.Host, *Response, error) {
+	var host models.Host
+	resp, err := c.get(ctx, "/api/hosts/"+pathEscape(id), nil, &host)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &host, resp, nil
+}
+
+// History returns the rollups of a host, leaving the resolution empty lets the node pick it
+func (c *Client) History(ctx context.Context, filter models.RollupFilter) (*apiv1.HistoryResponse, *Response, error) {
+	query := timeRange(filter.Start, filter.End)
+	setQuery(query, "resolution", string(filter.Resolution))
+	setQuery(query, "network", string(filter.Network))
+	setQuery(query, "type", string(filter.CheckType))
+
+	var history apiv1.HistoryResponse
+	resp, err := c.get(ctx, "/api/hosts/"+pathEscape(filter.HostID)+"/history", query, &history)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &history, resp, nil
+}
+
+// Checks returns a page of checks. Pass the cursor of the Next of a page as After to get the following page.
+func (c *Client) Checks(ctx context.Context, q models.CheckQuery) (*models.CheckPage, *Response, error) {
+	query := timeRange(q.Start, q.End)
+	setQuery(query, "host", q.HostID)
+	setQuery(query, "network", string(q.Network))
+	setQuery(query, "type", string(q.CheckType))
+	setQuery(query, "status", string(q.Status))
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.After != nil {
+		query.Set("cursor", q.After.String())
+	}
+
+	var page models.CheckPage
+	resp, err := c.get(ctx, "/api/checks", query, &page)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &page, resp, nil
+}
+
+// Restarts returns the restarts of a host seen by the node and a page of their timeline,
+// limited to the range and limit of the filter when they are set. Pass the cursor of the
+// Next of a response as After to get the following page of the timeline.
+func (c *Client) Restarts(ctx context.Context, id string, filter models.EventFilter) (*apiv1.RestartsResponse, *Response, error) {
+	query := timeRange(filter.Start, filter.End)
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	if filter.After != nil {
+		query.Set("cursor", filter.After.String())
+	}
+
+	var restarts apiv1.RestartsResponse
+	resp, err := c.get(ctx, "/api/hosts/"+pathEscape(id)+"/restarts", query, &restarts)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &restarts, resp, nil
+}
+
+// Incidents returns a page of the incidents of the node with the most recently started first.
+// Pass the cursor of the Next of a page as After to get the following page.
+func (c *Client) Incidents(ctx context.Context, filter models.IncidentFilter) (*models.IncidentPage, *Response, error) {
+	query := timeRange(filter.Start, filter.End)
+	setQuery(query, "host", filter.HostID)
+	setQuery(query, "network", string(filter.Network))
+	setQuery(query, "type", string(filter.CheckType))
+	if filter.OpenOnly {
+		query.Set("open", "true")
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	if filter.After != nil {
+		query.Set("cursor", filter.After.String())
+	}
+
+	var page models.IncidentPage
+	resp, err := c.get(ctx, "/api/incidents", query, &page)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &page, resp, nil
+}
+
+// Events returns a page of the events of the node oldest first. Pass the cursor of the Next
+// of a page as After to get the following page.
+func (c *Client) Events(ctx context.Context, filter models.EventFilter) (*models.EventPage, *Response, error) {
+	query := timeRange(filter.Start, filter.End)
+	setQuery(query, "host", filter.HostID)
+	if len(filter.Types) > 0 {
+		types := make([]string, len(filter.Types))
+		for i, t := range filter.Types {
+			types[i] = string(t)
+		}
+		query.Set("type", strings.Join(types, ","))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	if filter.After != nil {
+		query.Set("cursor", filter.After.String())
+	}
+
+	var page models.EventPage
+	resp, err := c.get(ctx, "/api/events", query, &page)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &page, resp, nil
+}
+
+// Mesh returns the full mesh collected by the node from every peer, only the cells of the
+// network when it is not empty
+func (c *Client) Mesh(ctx context.Context, network models.Network, refresh bool) (*models.MeshMatrix, *Response, error) {
+	query := refreshQuery(refresh)
+	setQuery(query, "network", string(network))
+
+	var matrix models.MeshMatrix
+	resp, err := c.get(ctx, "/api/mesh", query, &matrix)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &matrix, resp, nil
+}
+
+// Results returns the node's results against the host with the hostname
+func (c *Client) Results(ctx context.Context, hostname string) (*models.MeshResults, *Response, error) {
+	var results models.MeshResults
+	resp, err := c.get(ctx, "/api/results/"+pathEscape(hostname), nil, &results)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &results, resp, nil
+}
+
+// ResetUptime clears the uptime of a host in every window, it needs the admin token
+func (c *Client) ResetUptime(ctx context.Context, id string) (*Response, error) {
+	return c.do(ctx, "DELETE", "/api/admin/hosts/"+pathEscape(id)+"/uptime", nil, nil)
+}
+
+// Reconcile merges the duplicate hosts of the node now, it needs the admin token
+func (c *Client) Reconcile(ctx context.Context) (*models.ReconcileReport, *Response, error) {
+	var report models.ReconcileReport
+	resp, err := c.do(ctx, "POST", "/api/admin/reconcile", nil, &report)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &report, resp, nil
+}
+
+// WriterStats returns the queue of the node's database writer, it needs the admin token
+func (c *Client) WriterStats(ctx context.Context) (*apiv1.WriterStats, *Response, error) {
+	var stats apiv1.WriterStats
+	resp, err := c.get(ctx, "/api/admin/writer", nil, &stats)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &stats, resp, nil
+}
+
+func timeRange(start, end time.Time) url.Values {
+	query := url.Values{}
+	if !start.IsZero() {
+		query.Set("start", start.Format(time.RFC3339))
+	}
+	if !end.IsZero() {
+		query.Set("end", end.Format(time.RFC3339))
+	}
+	return query
+}
+
+func setQuery(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func refreshQuery(refresh bool) url.Values {
+	query := url.Values{}
+	if refresh {
+		query.Set("refresh", "true")
+	}
+	return query
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -18,24 +19,91 @@ const (
 )
 
 var (
-	webPort        = flag.Int("web.port", 80, "Port to use for the web and api interface")
-	servicePort    = flag.Int("service.port", 5500, "Port to use for the service endpoint")
-	serviceHosts   = flag.String("service.hosts", "", "Comma serparated list of hosts or file with hosts listed one per line to use for testing")
-	discoveryName  = flag.String("discovery.name", "", "DNS name for A record containing list of host ips")
-	parallelChecks = flag.Int("check.parallel", 20, "Number of checks to run in parallel at any time")
-	checkInterval  = flag.Duration("check.interval", 10*time.Second, "Time between checking each host")
+	webPort         = flag.Int("web.port", 80, "Port to use for the web and api interface")
+	servicePort     = flag.Int("service.port", 5500, "Port to use for the service endpoint")
+	serviceHosts    = flag.String("service.hosts", "", "Comma serparated list of hosts or file with hosts listed one per line to use for testing")
+	discoveryName   = flag.String("discovery.name", "", "DNS name for A record containing list of host ips")
+	parallelChecks  = flag.Int("check.parallel", 20, "Number of checks to run in parallel at any time")
+	checkInterval   = flag.Duration("check.interval", 10*time.Second, "Time between checking each host")
+	networks        = flag.String("networks", "", "Comma separated list of additional networks to test as name=ip or name=interface (ex. vpn=wg0,overlay=10.8.0.5)")
+	dbBackend       = flag.String("db.backend", "badger", "Storage backend to use, badger or memory. Memory keeps nothing after a restart")
+	dbPath          = flag.String("db.path", ".db", "Directory for the badger database")
+	dbMigrateDryRun = flag.Bool("db.migrate.dry-run", false, "Log the migrations the badger database needs and exit without changing it")
+	retentionMinute = flag.Duration("rollup.retention.minute", 48*time.Hour, "How long to keep 1 minute rollups of checks")
+	retentionHour   = flag.Duration("rollup.retention.hour", 30*24*time.Hour, "How long to keep 1 hour rollups of checks")
+	retentionDay    = flag.Duration("rollup.retention.day", 365*24*time.Hour, "How long to keep 1 day rollups of checks")
+	reconcileEvery  = flag.Duration("reconcile.interval", 10*time.Minute, "Time between merging duplicate hosts and cleaning stale indexes, 0 to only run from the admin api")
+	incidentMin     = flag.Int("incident.threshold", 2, "Consecutive failed checks of a type that open an incident")
+	incidentKeep    = flag.Duration("incident.retention", 365*24*time.Hour, "How long to keep incidents after they end")
+	eventKeep       = flag.Duration("events.retention", 30*24*time.Hour, "How long to keep the events of the mesh")
+	labels          = flag.String("labels", "", "Comma separated list of key=value labels this node publishes to its peers (ex. provider=aws,region=us-east)")
+	labelsFile      = flag.String("labels.file", "", "File of key=value labels, one per line")
+	peerSelector    = flag.String("peers.selector", "", "Only probe peers with matching labels (ex. region=us-east,provider!=aws)")
+	metricsPeer     = flag.String("metrics.peer-label", "hostname", "Value of the peer label of metrics, hostname, id or none to aggregate every peer")
+	metricsMaxPeers = flag.Int("metrics.max-peers", 500, "Peers with their own metrics, the metrics of any more peers are reported as peer=\"other\"")
+	metricsLabels   = flag.String("metrics.host-labels", "", "Comma separated list of host labels added to the metrics of each peer as label_<key>")
+	metricsBuckets  = flag.String("metrics.buckets", "0.001,0.0025,0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5", "Comma separated upper bounds in seconds of the latency histogram buckets, none to disable the histograms")
+	otlpEndpoint    = flag.String("otlp.endpoint", "", "OTLP/HTTP endpoint to push metrics and traces to (ex. http://collector:4318), empty to disable")
+	otlpInterval    = flag.Duration("otlp.interval", 30*time.Second, "Time between pushes of metrics and traces to the OTLP endpoint")
+	otlpHeaders     = flag.String("otlp.headers", "", "Comma separated list of key=value headers sent with each OTLP push")
+	meshCache       = flag.Duration("mesh.cache", 30*time.Second, "How long the full mesh collected from every peer is cached")
+	adminToken      = flag.String("admin.token", "", "Bearer token required by the admin api, empty to disable the admin api")
+	sources         = flag.String("sources", "", "Comma separated list of source ip or interface to send each network's probes from as network=ip or network=interface (ex. public=eth1)")
 )
 
 type Config struct {
-	Port           int
-	ServicePort    int
-	Hosts          []string
-	Discovery      string
-	PublicIPDNS    string
-	InternalPDNS   string
-	CheckInterval  time.Duration
-	ParallelChecks int
-	DownwardAPI    DownwardAPIDetails
+	Port            int
+	ServicePort     int
+	Hosts           []string
+	Discovery       string
+	PublicIPDNS     string
+	InternalPDNS    string
+	CheckInterval   time.Duration
+	ParallelChecks  int
+	Networks        map[string]string
+	Sources         map[string]string
+	DBBackend       string
+	DBPath          string
+	DBMigrateDryRun bool
+	Retention       RollupRetention
+	ReconcileEvery  time.Duration
+	Incidents       IncidentConfig
+	EventRetention  time.Duration
+	Labels          map[string]string
+	PeerSelector    string
+	Metrics         MetricsConfig
+	OTLP            OTLPConfig
+	MeshCacheTTL    time.Duration
+	AdminToken      string
+	DownwardAPI     DownwardAPIDetails
+}
+
+// RollupRetention is how long the rollups of each resolution are kept
+type RollupRetention struct {
+	Minute time.Duration
+	Hour   time.Duration
+	Day    time.Duration
+}
+
+// IncidentConfig controls when failures become an incident and how long incidents are kept
+type IncidentConfig struct {
+	Threshold int
+	Retention time.Duration
+}
+
+// MetricsConfig controls the labels and the number of series of the metrics
+type MetricsConfig struct {
+	PeerLabel  string
+	MaxPeers   int
+	HostLabels []string
+	Buckets    []float64
+}
+
+// OTLPConfig is where metrics and traces are pushed to, disabled without an endpoint
+type OTLPConfig struct {
+	Endpoint string
+	Interval time.Duration
+	Headers  map[string]string
 }
 
 type DownwardAPIDetails struct {
@@ -116,18 +184,178 @@ func LoadEnvConfig() (*Config, error) {
 		}
 	}
 
+	networksStr := os.Getenv("NETWORKS")
+	if networksStr == "" {
+		networksStr = *networks
+	}
+	networks, err := parseNetworks(networksStr)
+	if err != nil {
+		return nil, err
+	}
+
+	sourcesStr := os.Getenv("SOURCES")
+	if sourcesStr == "" {
+		sourcesStr = *sources
+	}
+	sources, err := parseNetworks(sourcesStr)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := os.Getenv("DB_BACKEND")
+	if backend == "" {
+		backend = *dbBackend
+	}
+
+	path := os.Getenv("DB_PATH")
+	if path == "" {
+		path = *dbPath
+	}
+
+	migrateDryRun := *dbMigrateDryRun
+	if str := os.Getenv("DB_MIGRATE_DRY_RUN"); str != "" {
+		migrateDryRun, err = strconv.ParseBool(str)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	retention := RollupRetention{
+		Minute: *retentionMinute,
+		Hour:   *retentionHour,
+		Day:    *retentionDay,
+	}
+	for env, value := range map[string]*time.Duration{
+		"ROLLUP_RETENTION_MINUTE": &retention.Minute,
+		"ROLLUP_RETENTION_HOUR":   &retention.Hour,
+		"ROLLUP_RETENTION_DAY":    &retention.Day,
+	} {
+		if str := os.Getenv(env); str != "" {
+			*value, err = time.ParseDuration(str)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	reconcileInterval := *reconcileEvery
+	if str := os.Getenv("RECONCILE_INTERVAL"); str != "" {
+		reconcileInterval, err = time.ParseDuration(str)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	incidents := IncidentConfig{
+		Threshold: *incidentMin,
+		Retention: *incidentKeep,
+	}
+	if str := os.Getenv("INCIDENT_THRESHOLD"); str != "" {
+		incidents.Threshold, err = strconv.Atoi(str)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if str := os.Getenv("INCIDENT_RETENTION"); str != "" {
+		incidents.Retention, err = time.ParseDuration(str)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	eventRetention := *eventKeep
+	if str := os.Getenv("EVENT_RETENTION"); str != "" {
+		eventRetention, err = time.ParseDuration(str)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	labelsStr := os.Getenv("LABELS")
+	if labelsStr == "" {
+		labelsStr = *labels
+	}
+	labelsPath := os.Getenv("LABELS_FILE")
+	if labelsPath == "" {
+		labelsPath = *labelsFile
+	}
+	labels, err := loadLabels(labelsPath, labelsStr, os.Environ())
+	if err != nil {
+		return nil, err
+	}
+
+	selector := os.Getenv("PEER_SELECTOR")
+	if selector == "" {
+		selector = *peerSelector
+	}
+
+	metrics, err := loadMetricsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	otlp := OTLPConfig{
+		Endpoint: os.Getenv("OTLP_ENDPOINT"),
+		Interval: *otlpInterval,
+	}
+	if otlp.Endpoint == "" {
+		otlp.Endpoint = *otlpEndpoint
+	}
+	if str := os.Getenv("OTLP_INTERVAL"); str != "" {
+		otlp.Interval, err = time.ParseDuration(str)
+		if err != nil {
+			return nil, err
+		}
+	}
+	headersStr := os.Getenv("OTLP_HEADERS")
+	if headersStr == "" {
+		headersStr = *otlpHeaders
+	}
+	otlp.Headers, err = parseHeaders(headersStr)
+	if err != nil {
+		return nil, err
+	}
+
+	meshCacheTTL := *meshCache
+	if str := os.Getenv("MESH_CACHE_TTL"); str != "" {
+		meshCacheTTL, err = time.ParseDuration(str)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		token = *adminToken
+	}
+
 	internalIP := "self.metadata.edgeengine.internal"
 	publicIP := "self.metadata.compute.edgeengine.io"
 
 	return &Config{
-		Port:           port,
-		ServicePort:    servicePort,
-		Discovery:      discoveryURL,
-		CheckInterval:  checkInterval,
-		InternalPDNS:   internalIP,
-		PublicIPDNS:    publicIP,
-		ParallelChecks: parallelChecks,
-		Hosts:          hosts,
+		Port:            port,
+		ServicePort:     servicePort,
+		Discovery:       discoveryURL,
+		CheckInterval:   checkInterval,
+		InternalPDNS:    internalIP,
+		PublicIPDNS:     publicIP,
+		ParallelChecks:  parallelChecks,
+		Hosts:           hosts,
+		Networks:        networks,
+		Sources:         sources,
+		DBBackend:       backend,
+		DBPath:          path,
+		DBMigrateDryRun: migrateDryRun,
+		Retention:       retention,
+		ReconcileEvery:  reconcileInterval,
+		Incidents:       incidents,
+		EventRetention:  eventRetention,
+		Labels:          labels,
+		PeerSelector:    selector,
+		Metrics:         *metrics,
+		OTLP:            otlp,
+		MeshCacheTTL:    meshCacheTTL,
+		AdminToken:      token,
 		DownwardAPI: DownwardAPIDetails{
 			CityCode:  os.Getenv(cityCode),
 			Longitude: os.Getenv(longitude),
@@ -135,3 +363,88 @@ func LoadEnvConfig() (*Config, error) {
 		},
 	}, nil
 }
+
+func loadMetricsConfig() (*MetricsConfig, error) {
+	var err error
+
+	metrics := &MetricsConfig{
+		PeerLabel: os.Getenv("METRICS_PEER_LABEL"),
+		MaxPeers:  *metricsMaxPeers,
+	}
+	if metrics.PeerLabel == "" {
+		metrics.PeerLabel = *metricsPeer
+	}
+	switch metrics.PeerLabel {
+	case "hostname", "id", "none":
+	default:
+		return nil, fmt.Errorf("invalid metrics peer label %q, expected hostname, id or none", metrics.PeerLabel)
+	}
+
+	if str := os.Getenv("METRICS_MAX_PEERS"); str != "" {
+		metrics.MaxPeers, err = strconv.Atoi(str)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hostLabels := os.Getenv("METRICS_HOST_LABELS")
+	if hostLabels == "" {
+		hostLabels = *metricsLabels
+	}
+	metrics.HostLabels, err = parseMetricsHostLabels(hostLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := os.Getenv("METRICS_BUCKETS")
+	if buckets == "" {
+		buckets = *metricsBuckets
+	}
+	if buckets != "none" {
+		for _, str := range strings.Split(buckets, ",") {
+			bound, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid metrics bucket %q: %v", str, err)
+			}
+			if n := len(metrics.Buckets); n > 0 && bound <= metrics.Buckets[n-1] {
+				return nil, fmt.Errorf("metrics buckets must be increasing, %v is not above %v", bound, metrics.Buckets[n-1])
+			}
+			metrics.Buckets = append(metrics.Buckets, bound)
+		}
+	}
+	return metrics, nil
+}
+
+// parseNetworks parses name=ip or name=interface pairs into a map of network name to address or interface
+func parseNetworks(networks string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	if networks == "" {
+		return parsed, nil
+	}
+
+	for _, network := range strings.Split(networks, ",") {
+		parts := strings.SplitN(strings.TrimSpace(network), "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid network %q, expected name=ip or name=interface", network)
+		}
+		parsed[parts[0]] = parts[1]
+	}
+	return parsed, nil
+}
+
+// parseHeaders parses key=value pairs into a map of header name to value
+func parseHeaders(headers string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	if headers == "" {
+		return parsed, nil
+	}
+
+	for _, header := range strings.Split(headers, ",") {
+		parts := strings.SplitN(strings.TrimSpace(header), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid header %q, expected key=value", header)
+		}
+		parsed[parts[0]] = parts[1]
+	}
+	return parsed, nil
+}
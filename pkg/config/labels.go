@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// labelEnvPrefix is the prefix of environment variables that set a label, LABEL_REGION=us-east sets region=us-east
+const labelEnvPrefix = "LABEL_"
+
+var (
+	labelKeyRegex   = regexp.MustCompile(`^[a-z0-9]([a-z0-9._/-]*[a-z0-9])?$`)
+	labelValueRegex = regexp.MustCompile(`^[A-Za-z0-9._-]*$`)
+
+	// invalidMetricLabelChars are the characters of a label key that can't be in a metric label name
+	invalidMetricLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// loadLabels merges the labels from the file, the comma separated list and LABEL_ environment
+// variables. Later sources override earlier ones.
+func loadLabels(file, list string, environ []string) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		// One key=value per line, blank lines and lines starting with # are skipped
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if err := setLabel(labels, line); err != nil {
+				return nil, err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if list != "" {
+		for _, label := range strings.Split(list, ",") {
+			if err := setLabel(labels, strings.TrimSpace(label)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, env := range environ {
+		if !strings.HasPrefix(env, labelEnvPrefix) {
+			continue
+		}
+		// Keys are lowercase with - instead of _, LABEL_CLUSTER_NAME=a sets cluster-name=a
+		parts := strings.SplitN(strings.TrimPrefix(env, labelEnvPrefix), "=", 2)
+		label := strings.Replace(strings.ToLower(parts[0]), "_", "-", -1) + "=" + parts[1]
+		if err := setLabel(labels, label); err != nil {
+			return nil, err
+		}
+	}
+	return labels, nil
+}
+
+func setLabel(labels map[string]string, label string) error {
+	parts := strings.SplitN(label, "=", 2)
+	if len(parts) != 2 || !labelKeyRegex.MatchString(parts[0]) || !labelValueRegex.MatchString(parts[1]) {
+		return fmt.Errorf("invalid label %q, expected key=value with a lowercase key", label)
+	}
+	labels[parts[0]] = parts[1]
+	return nil
+}
+
+// MetricLabelName is the metric label a host label is added to the metrics of a peer as
+func MetricLabelName(key string) string {
+	return "label_" + invalidMetricLabelChars.ReplaceAllString(key, "_")
+}
+
+// parseMetricsHostLabels parses the comma separated host labels added to the metrics of each
+// peer. Keys such as a.b and a-b would both be label_a_b so they can't be used together.
+func parseMetricsHostLabels(list string) ([]string, error) {
+	var keys []string
+	names := make(map[string]string)
+	for _, key := range strings.Split(list, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		name := MetricLabelName(key)
+		if other, ok := names[name]; ok {
+			if other == key {
+				continue
+			}
+			return nil, fmt.Errorf("metrics host labels %q and %q would both be reported as %s", other, key, name)
+		}
+		names[name] = key
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMetricsHostLabels(t *testing.T) {
+	keys, err := parseMetricsHostLabels(" region, cloud.provider,region,,pop ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"region", "cloud.provider", "pop"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+
+	for _, list := range []string{"a.b,a-b", "cloud/provider,cloud.provider", "a_b,a.b"} {
+		if _, err := parseMetricsHostLabels(list); err == nil {
+			t.Errorf("%q: expected the keys reported as the same metric label to be rejected", list)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/dgraph-io/badger"
+)
+
+const (
+	hostsPrefix     = "hosts.id."
+	hostnamePrefix  = "hosts.hostname."
+	ipPrefix        = "hosts.ip."
+	inboundPrefix   = "inbound."
+	reflexivePrefix = "reflexive."
+)
+
+// Badger is the Store kept on disk with badger
+type Badger struct {
+	db     *badger.DB
+	writer *writer
+}
+
+// NewBadger opens or creates the database in dir
+func NewBadger(dir string) (*Badger, error) {
+	opts := badger.DefaultOptions(dir).WithSyncWrites(false)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Badger{db: db, writer: newWriter(db)}, nil
+}
+
+// OpenBadgerReadOnly opens the database in dir without writing to it, for commands that only
+// read such as backups. Nothing is migrated and other read-only processes can open it too.
+// There is no writer so checks and inbound probes can't be added.
+func OpenBadgerReadOnly(dir string) (*Badger, error) {
+	opts := badger.DefaultOptions(dir).WithReadOnly(true)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Badger{db: db}, nil
+}
+
+// Close writes the queued checks before closing the database
+func (b *Badger) Close() error {
+	b.writer.close()
+	return b.db.Close()
+}
+
+// Sized is a Store that can report how much space it takes on disk
+type Sized interface {
+	Size() (lsm, vlog int64)
+}
+
+func (b *Badger) Size() (lsm, vlog int64) {
+	return b.db.Size()
+}
+
+func (b *Badger) WriterStats() WriterStats {
+	return b.writer.stats()
+}
+
+// checks.<host id>.<network>.<type>.<unix nanoseconds>, padded so keys sort by time
+func checkKey(hostID string, network models.Network, checkType models.CheckType, checkedAt time.Time) []byte {
+	return []byte(fmt.Sprintf("checks.%s.%s.%s.%019d", hostID, network, checkType, checkedAt.UnixNano()))
+}
+
+func checksPrefix(hostID string) []byte {
+	return []byte("checks." + hostID + ".")
+}
+
+// checks.<host id>.latest.<network>.<type>
+func latestCheckKey(hostID string, network models.Network, checkType models.CheckType) []byte {
+	return []byte(fmt.Sprintf("checks.%s.latest.%s.%s", hostID, network, checkType))
+}
+
+func latestChecksPrefix(hostID string) []byte {
+	return []byte("checks." + hostID + ".latest.")
+}
+
+// uptime.<host id>.<network>.<type>.<resolution>.<unix bucket start>
+func uptimeKey(hostID string, b models.UptimeBucket) []byte {
+	return []byte(fmt.Sprintf("uptime.%s.%s.%s.%s.%d", hostID, b.Network, b.CheckType, b.Resolution, b.Start.Unix()))
+}
+
+func uptimePrefix(hostID string) []byte {
+	return []byte("uptime." + hostID + ".")
+}
+
+// inbound.<host id>.<type>
+func inboundKey(hostID string, checkType models.CheckType) []byte {
+	return []byte(fmt.Sprintf("%s%s.%s", inboundPrefix, hostID, checkType))
+}
+
+// reflexive.<host id>.<network>.<type>
+func reflexiveKey(hostID string, network models.Network, checkType models.CheckType) []byte {
+	return []byte(fmt.Sprintf("%s%s.%s.%s", reflexivePrefix, hostID, network, checkType))
+}
+
+// getJSON unmarshals the value of key into v
+func getJSON(txn *badger.Txn, key []byte, v interface{}) error {
+	item, err := txn.Get(key)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return item.Value(func(val []byte) error {
+		return json.Unmarshal(val, v)
+	})
+}
+
+// getIndexed looks up the host id stored at key and returns that host
+func getIndexed(txn *badger.Txn, key []byte, host *models.Host) error {
+	item, err := txn.Get(key)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	var id string
+	item.Value(func(val []byte) error {
+		id = string(val)
+		return nil
+	})
+
+	return getJSON(txn, []byte(hostsPrefix+id), host)
+}
+
+func (b *Badger) GetHostByHostname(hostname string) (*models.Host, error) {
+	var host models.Host
+	err := b.db.View(func(txn *badger.Txn) error {
+		return getIndexed(txn, []byte(hostnamePrefix+hostname), &host)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &host, nil
+}
+
+func (b *Badger) GetHostByID(id string) (*models.Host, error) {
+	var host models.Host
+	err := b.db.View(func(txn *badger.Txn) error {
+		if err := getJSON(txn, []byte(hostsPrefix+id), &host); err != nil {
+			return err
+		}
+
+		if err := addLatestStatuses(txn, &host); err != nil {
+			return err
+		}
+
+		if err := addChecks(txn, &host); err != nil {
+			return err
+		}
+
+		if err := setUptimes(txn, &host); err != nil {
+			return err
+		}
+
+		return addInbound(txn, &host)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &host, nil
+}
+
+func (b *Badger) GetHostByIP(ip string) (*models.Host, error) {
+	var host models.Host
+	err := b.db.View(func(txn *badger.Txn) error {
+		return getIndexed(txn, []byte(ipPrefix+ip), &host)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &host, nil
+}
+
+func (b *Badger) GetHostsWithStatuses() ([]models.Host, error) {
+	hosts, err := b.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.db.View(func(txn *badger.Txn) error {
+		for i := range hosts {
+			if err := addLatestStatuses(txn, &hosts[i]); err != nil {
+				return err
+			}
+
+			if err := setUptimes(txn, &hosts[i]); err != nil {
+				return err
+			}
+
+			if err := addInbound(txn, &hosts[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+func (b *Badger) GetHosts() ([]models.Host, error) {
+	var hosts []models.Host
+	err := b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek([]byte(hostsPrefix)); it.ValidForPrefix([]byte(hostsPrefix)); it.Next() {
+			var host models.Host
+
+			item := it.Item()
+
+			if strings.HasSuffix(string(item.Key()), models.CurrentHostID) {
+				continue
+			}
+
+			err := item.Value(func(val []byte) error {
+				if err := json.Unmarshal(val, &host); err != nil {
+					return err
+				}
+
+				hosts = append(hosts, host)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	models.SortHosts(hosts)
+	return hosts, nil
+}
+
+func (b *Badger) SaveHost(h *models.Host) error {
+	h.BeforeSave()
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		if err := removeStaleIndexes(txn, h); err != nil {
+			return err
+		}
+
+		jsonHost, _ := json.Marshal(h)
+		if err := txn.Set([]byte(hostsPrefix+h.ID), jsonHost); err != nil {
+			return err
+		}
+
+		if err := txn.Set([]byte(hostnamePrefix+h.Hostname), []byte(h.ID)); err != nil {
+			return err
+		}
+
+		for _, addr := range h.NetworkAddresses() {
+			if err := txn.Set([]byte(ipPrefix+addr), []byte(h.ID)); err != nil {
+				return err
+			}
+		}
+
+		if h.DiscoveredIP != "" {
+			if err := txn.Set([]byte(ipPrefix+h.DiscoveredIP), []byte(h.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// removeStaleIndexes deletes the index entries of the stored host for a hostname or
+// addresses it no longer has, unless they were already moved to another host
+func removeStaleIndexes(txn *badger.Txn, h *models.Host) error {
+	var prev models.Host
+	if err := getJSON(txn, []byte(hostsPrefix+h.ID), &prev); err != nil {
+		if err == ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	var stale [][]byte
+	if prev.Hostname != h.Hostname {
+		stale = append(stale, []byte(hostnamePrefix+prev.Hostname))
+	}
+	for _, addr := range prev.NetworkAddresses() {
+		if !h.HasIP(addr) && addr != h.DiscoveredIP {
+			stale = append(stale, []byte(ipPrefix+addr))
+		}
+	}
+
+	for _, key := range stale {
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		id, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if string(id) != h.ID {
+			continue
+		}
+
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Badger) SetIPOwner(h *models.Host, ip string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(ipPrefix+ip), []byte(h.ID))
+	})
+}
+
+func (b *Badger) GetCurrentHost() (*models.Host, error) {
+	var host models.Host
+	err := b.db.View(func(txn *badger.Txn) error {
+		return getJSON(txn, []byte(hostsPrefix+models.CurrentHostID), &host)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &host, nil
+}
+
+func (b *Badger) SaveCurrentHost(h *models.Host) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		hostJSON, _ := json.Marshal(h)
+		return txn.Set([]byte(hostsPrefix+h.ID), hostJSON)
+	})
+}
+
+// keyChange is a planned write of a migration or merge. A nil value deletes the key.
+type keyChange struct {
+	key       []byte
+	value     []byte
+	expiresAt uint64
+}
+
+// writeChanges batches the changes so they are not limited by the size of a transaction
+func (b *Badger) writeChanges(changes []keyChange) error {
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, c := range changes {
+		var err error
+		switch {
+		case c.value == nil:
+			err = wb.Delete(c.key)
+		case c.expiresAt > 0:
+			ttl := time.Until(time.Unix(int64(c.expiresAt), 0))
+			if ttl <= 0 {
+				continue
+			}
+			err = wb.SetEntry(badger.NewEntry(c.key, c.value).WithTTL(ttl))
+		default:
+			err = wb.Set(c.key, c.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
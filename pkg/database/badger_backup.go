@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/dgraph-io/badger"
+)
+
+// maxPendingRestoreWrites is how many batches of a backup are written to badger at once during a restore
+const maxPendingRestoreWrites = 256
+
+// Backupable is a Store that can stream a consistent copy of itself
+type Backupable interface {
+	Backup(w io.Writer) error
+}
+
+// Backup streams a snapshot of the database to w in badger's backup format
+func (b *Badger) Backup(w io.Writer) error {
+	_, err := b.db.Backup(w, 0)
+	return err
+}
+
+// RestoreBadger loads a backup into a new database in dir. The directory must not exist
+// or be empty so a restore never mixes with existing history.
+func RestoreBadger(dir string, r io.Reader) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(files) > 0 {
+		return fmt.Errorf("can't restore into %s, the directory is not empty", dir)
+	}
+
+	db, err := badger.Open(badger.DefaultOptions(dir))
+	if err != nil {
+		return err
+	}
+
+	if err := db.Load(r, maxPendingRestoreWrites); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
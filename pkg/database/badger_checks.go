@@ -0,0 +1,188 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/dgraph-io/badger"
+)
+
+// AddCheck queues the check for the writer. It is stored shortly after, in order with the
+// other checks of the host.
+func (b *Badger) AddCheck(h *models.Host, check *models.Check) error {
+	check.Stamp(h)
+	return b.writer.enqueue(writeRequest{hostID: h.ID, check: check})
+}
+
+func addChecks(txn *badger.Txn, h *models.Host) error {
+	h.Checks = models.NewServiceChecks()
+
+	it := txn.NewIterator(badger.IteratorOptions{})
+	defer it.Close()
+
+	prefix := checksPrefix(h.ID)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+
+		// checks.<host id>.<network>.<type>.<timestamp>, latest checks are loaded separately
+		keyParts := strings.Split(string(item.Key()), ".")
+		if len(keyParts) != 5 || keyParts[2] == "latest" {
+			continue
+		}
+
+		var check models.Check
+		err := item.Value(func(val []byte) error {
+			return decodeCheck(val, &check)
+		})
+		if err != nil {
+			return err
+		}
+
+		h.Checks.Network(models.Network(keyParts[2])).Add(check)
+	}
+	return nil
+}
+
+func addLatestStatuses(txn *badger.Txn, h *models.Host) error {
+	h.LatestChecks = models.NewServiceChecks()
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := latestChecksPrefix(h.ID)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+
+		// checks.<host id>.latest.<network>.<type>
+		keyParts := strings.Split(string(item.Key()), ".")
+		if len(keyParts) != 5 {
+			continue
+		}
+
+		var check models.Check
+		err := item.Value(func(val []byte) error {
+			return decodeCheck(val, &check)
+		})
+		if err != nil {
+			return err
+		}
+
+		h.LatestChecks.Network(models.Network(keyParts[3])).Set(check)
+	}
+	return nil
+}
+
+func setUptimes(txn *badger.Txn, h *models.Host) error {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	now := time.Now()
+	uptime := models.NewCheckUptime()
+	prefix := uptimePrefix(h.ID)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		// uptime.<host id>.<network>.<type>.<resolution>.<unix bucket start>, lifetime
+		// counters from before uptime was windowed are skipped
+		keyParts := strings.Split(string(it.Item().Key()), ".")
+		if len(keyParts) != 6 {
+			continue
+		}
+
+		var bucket models.UptimeBucket
+		err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &bucket)
+		})
+		if err != nil {
+			return err
+		}
+
+		uptime.AddBucket(bucket, now)
+	}
+
+	h.CheckUptime = uptime
+	return nil
+}
+
+// ResetUptime removes every uptime bucket of the host. It runs on the writer so a batch
+// can't write back buckets it read before the reset.
+func (b *Badger) ResetUptime(hostID string) error {
+	return b.writer.exclusive(func() error {
+		return b.resetUptime(hostID)
+	})
+}
+
+func (b *Badger) resetUptime(hostID string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{})
+		defer it.Close()
+
+		var keys [][]byte
+		prefix := uptimePrefix(hostID)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RecordInbound queues the probe for the writer
+func (b *Badger) RecordInbound(h *models.Host, checkType models.CheckType, bytes int) error {
+	return b.writer.enqueue(writeRequest{hostID: h.ID, inboundType: checkType, inboundBytes: bytes})
+}
+
+func addInbound(txn *badger.Txn, h *models.Host) error {
+	h.Inbound = &models.InboundView{}
+	for _, checkType := range []models.CheckType{models.CheckTCP, models.CheckUDP} {
+		var stats models.InboundStats
+		err := getJSON(txn, inboundKey(h.ID, checkType), &stats)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		h.Inbound.Set(checkType, stats)
+	}
+	return nil
+}
+
+func (b *Badger) SaveReflexiveObservation(o *models.ReflexiveObservation) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		data, _ := json.Marshal(o)
+		return txn.SetEntry(badger.NewEntry(reflexiveKey(o.HostID, o.Network, o.CheckType), data).WithTTL(checkTTL))
+	})
+}
+
+func (b *Badger) GetReflexiveObservations() ([]models.ReflexiveObservation, error) {
+	var observations []models.ReflexiveObservation
+	err := b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(reflexivePrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var o models.ReflexiveObservation
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &o)
+			})
+			if err != nil {
+				return err
+			}
+			observations = append(observations, o)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return observations, nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/dgraph-io/badger"
+)
+
+const eventsPrefix = "events."
+
+// events.<unix nanoseconds>.<event id>
+func eventKey(e *models.Event) []byte {
+	return []byte(fmt.Sprintf("%s%019d.%s", eventsPrefix, e.At.UnixNano(), e.ID))
+}
+
+func (b *Badger) SaveEvent(e *models.Event, retention time.Duration) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(badger.NewEntry(eventKey(e), data).WithTTL(retention))
+	})
+}
+
+// GetEvents range scans the time ordered event keys from the start of the filter or the
+// cursor. At most a page plus one of matches is read to know if there is a next page.
+func (b *Badger) GetEvents(filter models.EventFilter) (*models.EventPage, error) {
+	var events []models.Event
+	err := b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(eventsPrefix)
+		seek := prefix
+		if filter.After != nil {
+			seek = []byte(fmt.Sprintf("%s%019d.%s", eventsPrefix, filter.After.At.UnixNano(), filter.After.ID))
+		} else if !filter.Start.IsZero() {
+			seek = []byte(fmt.Sprintf("%s%019d", eventsPrefix, filter.Start.UnixNano()))
+		}
+
+		limit := filter.PageLimit() + 1
+		for it.Seek(seek); it.ValidForPrefix(prefix) && len(events) < limit; it.Next() {
+			// Stop at the end of the range by the time in the key before reading the value
+			key := strings.TrimPrefix(string(it.Item().Key()), eventsPrefix)
+			at, parseErr := strconv.ParseInt(key[:strings.Index(key, ".")], 10, 64)
+			if parseErr == nil && !filter.End.IsZero() && !time.Unix(0, at).Before(filter.End) {
+				break
+			}
+
+			var e models.Event
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &e)
+			})
+			if err != nil {
+				return err
+			}
+
+			if filter.Match(e) {
+				events = append(events, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filter.Page(events), nil
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/dgraph-io/badger"
+)
+
+const incidentsPrefix = "incidents."
+
+// incidents.<unix nanoseconds start>.<incident id>
+func incidentKey(i *models.Incident) []byte {
+	return []byte(fmt.Sprintf("%s%019d.%s", incidentsPrefix, i.StartedAt.UnixNano(), i.ID))
+}
+
+func (b *Badger) SaveIncident(i *models.Incident, retention time.Duration) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		data, err := json.Marshal(i)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(badger.NewEntry(incidentKey(i), data).WithTTL(retention))
+	})
+}
+
+// GetIncidents range scans the time ordered incident keys back from the end of the filter
+// or the cursor. At most a page plus one of matches is read to know if there is a next page.
+func (b *Badger) GetIncidents(filter models.IncidentFilter) (*models.IncidentPage, error) {
+	var incidents []models.Incident
+	err := b.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// Reverse iteration starts at the last key before the seek key
+		prefix := []byte(incidentsPrefix)
+		seek := append([]byte(incidentsPrefix), 0xff)
+		if filter.After != nil {
+			seek = []byte(fmt.Sprintf("%s%019d.%s", incidentsPrefix, filter.After.At.UnixNano(), filter.After.ID))
+		} else if !filter.End.IsZero() {
+			seek = []byte(fmt.Sprintf("%s%019d", incidentsPrefix, filter.End.UnixNano()))
+		}
+
+		limit := filter.PageLimit() + 1
+		for it.Seek(seek); it.ValidForPrefix(prefix) && len(incidents) < limit; it.Next() {
+			var i models.Incident
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &i)
+			})
+			if err != nil {
+				return err
+			}
+
+			if filter.Match(i) {
+				incidents = append(incidents, i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return filter.Page(incidents), nil
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/dgraph-io/badger"
+)
+
+const schemaVersionKey = "schema.version"
+
+type migration struct {
+	version     int
+	description string
+	plan        func(txn *badger.Txn) ([]keyChange, error)
+}
+
+// migrations upgrade the keys and values of the database in order. Add new ones to the
+// end with the next version, never change one that has been released.
+var migrations = []migration{
+	{version: 1, description: "store host ids as strings", plan: planStringHostIDs},
+	{version: 2, description: "key checks by unix nanoseconds", plan: planNanosecondCheckKeys},
+	{version: 3, description: "remove lifetime uptime counters", plan: planRemoveLifetimeUptime},
+	{version: 4, description: "encode checks as msgpack", plan: planEncodeChecks},
+}
+
+// SchemaVersion is the version of the keys and values written by this version
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+func (b *Badger) GetSchemaVersion() (int, error) {
+	var version int
+	err := b.db.View(func(txn *badger.Txn) error {
+		return getJSON(txn, []byte(schemaVersionKey), &version)
+	})
+	if err != nil && err != ErrNotFound {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Migrate runs every migration newer than the stored schema version. In a dry run the
+// changes are counted and logged but nothing is written.
+func (b *Badger) Migrate(dryRun bool) error {
+	version, err := b.GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than the supported version %d", version, SchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		var changes []keyChange
+		err := b.db.View(func(txn *badger.Txn) error {
+			var planErr error
+			changes, planErr = m.plan(txn)
+			return planErr
+		})
+		if err != nil {
+			return fmt.Errorf("error planning migration %d (%s): %v", m.version, m.description, err)
+		}
+
+		if dryRun {
+			log.Printf("dry run: migration %d (%s) would change %d keys", m.version, m.description, len(changes))
+			continue
+		}
+
+		if err := b.apply(changes, m.version); err != nil {
+			return fmt.Errorf("error running migration %d (%s): %v", m.version, m.description, err)
+		}
+		log.Printf("ran migration %d (%s), changed %d keys", m.version, m.description, len(changes))
+	}
+	return nil
+}
+
+// apply writes the changes of a migration and then its version. The changes are safe to
+// repeat if the version is not written.
+func (b *Badger) apply(changes []keyChange, version int) error {
+	data, _ := json.Marshal(version)
+	return b.writeChanges(append(changes, keyChange{key: []byte(schemaVersionKey), value: data}))
+}
+
+// planStringHostIDs rewrites hosts stored with an integer id
+func planStringHostIDs(txn *badger.Txn) ([]keyChange, error) {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	var changes []keyChange
+	prefix := []byte(hostsPrefix)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		val, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		upgraded := models.UpgradeHostJSON(val)
+		if string(upgraded) == string(val) {
+			continue
+		}
+
+		var host models.Host
+		if err := json.Unmarshal(upgraded, &host); err != nil {
+			return nil, err
+		}
+		data, _ := json.Marshal(host)
+		changes = append(changes, keyChange{key: it.Item().KeyCopy(nil), value: data})
+	}
+	return changes, nil
+}
+
+// planNanosecondCheckKeys moves checks keyed by unix seconds, where checks in the same
+// second overwrote each other, to keys by unix nanoseconds
+func planNanosecondCheckKeys(txn *badger.Txn) ([]keyChange, error) {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	var changes []keyChange
+	prefix := []byte("checks.")
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+
+		// checks.<host id>.<network>.<type>.<unix seconds>
+		keyParts := strings.Split(string(item.Key()), ".")
+		if len(keyParts) != 5 || keyParts[2] == "latest" || len(keyParts[4]) >= 19 {
+			continue
+		}
+		if _, err := strconv.ParseInt(keyParts[4], 10, 64); err != nil {
+			continue
+		}
+
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var check models.Check
+		if err := decodeCheck(val, &check); err != nil {
+			return nil, err
+		}
+
+		key := checkKey(keyParts[1], models.Network(keyParts[2]), models.CheckType(keyParts[3]), check.CheckedAt)
+		changes = append(changes,
+			keyChange{key: key, value: val, expiresAt: item.ExpiresAt()},
+			keyChange{key: item.KeyCopy(nil)},
+		)
+	}
+	return changes, nil
+}
+
+// planRemoveLifetimeUptime deletes the uptime.<host id>.<network>.<type> counters replaced by windowed buckets
+func planRemoveLifetimeUptime(txn *badger.Txn) ([]keyChange, error) {
+	it := txn.NewIterator(badger.IteratorOptions{})
+	defer it.Close()
+
+	var changes []keyChange
+	prefix := []byte("uptime.")
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if len(strings.Split(string(it.Item().Key()), ".")) != 4 {
+			continue
+		}
+		changes = append(changes, keyChange{key: it.Item().KeyCopy(nil)})
+	}
+	return changes, nil
+}
+
+// planEncodeChecks re-encodes checks stored as json in the versioned msgpack envelope
+func planEncodeChecks(txn *badger.Txn) ([]keyChange, error) {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	var changes []keyChange
+	prefix := []byte("checks.")
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(val) == 0 || val[0] != '{' {
+			continue
+		}
+
+		var check models.Check
+		if err := decodeCheck(val, &check); err != nil {
+			return nil, err
+		}
+
+		data, err := encodeCheck(&check)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, keyChange{key: item.KeyCopy(nil), value: data, expiresAt: item.ExpiresAt()})
+	}
+	return changes, nil
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/dgraph-io/badger"
+)
+
+// writeBaseline writes a host, its latest check, a check and a lifetime uptime counter the
+// way the first released version stored them, before the schema was versioned
+func writeBaseline(t *testing.T, b *Badger, checkedAt time.Time) {
+	check, err := json.Marshal(models.Check{
+		ID:           "check-1",
+		HostID:       "1",
+		Status:       models.StatusSuccess,
+		ResponseTime: time.Millisecond,
+		Network:      models.NetworkPublic,
+		CheckType:    models.CheckTCP,
+		CheckedAt:    checkedAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseline := map[string][]byte{
+		hostsPrefix + "1":                                       []byte(`{"id":1,"hostname":"node-1","publicIp":"203.0.113.1"}`),
+		hostnamePrefix + "node-1":                               []byte("1"),
+		ipPrefix + "203.0.113.1":                                []byte("1"),
+		"checks.1.latest.public.TCP":                            check,
+		"uptime.1.public.TCP":                                   []byte(`{"total":1,"success":1}`),
+		fmt.Sprintf("checks.1.public.TCP.%d", checkedAt.Unix()): check,
+	}
+	err = b.db.Update(func(txn *badger.Txn) error {
+		for key, value := range baseline {
+			if err := txn.Set([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// snapshot returns every key and value in the database
+func snapshot(t *testing.T, b *Badger) map[string][]byte {
+	kv := make(map[string][]byte)
+	err := b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			kv[string(it.Item().Key())] = val
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kv
+}
+
+func assertSnapshot(t *testing.T, what string, got, want map[string][]byte) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: got %d keys, expected %d", what, len(got), len(want))
+	}
+	for key, value := range want {
+		if !bytes.Equal(got[key], value) {
+			t.Errorf("%s: key %s changed", what, key)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	b, done := newTestBadger(t)
+	defer done()
+
+	checkedAt := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	writeBaseline(t, b, checkedAt)
+	baseline := snapshot(t, b)
+
+	// A dry run writes nothing, not even the version
+	if err := b.Migrate(true); err != nil {
+		t.Fatal(err)
+	}
+	assertSnapshot(t, "dry run", snapshot(t, b), baseline)
+	if version, err := b.GetSchemaVersion(); err != nil || version != 0 {
+		t.Fatalf("expected the dry run to leave version 0, got %d %v", version, err)
+	}
+
+	if err := b.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := b.GetSchemaVersion(); err != nil || version != SchemaVersion() {
+		t.Fatalf("expected version %d, got %d %v", SchemaVersion(), version, err)
+	}
+
+	host, err := b.GetHostByID("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.Hostname != "node-1" {
+		t.Errorf("expected the host with a string id, got %+v", host)
+	}
+
+	migrated := snapshot(t, b)
+	if _, ok := migrated[fmt.Sprintf("checks.1.public.TCP.%d", checkedAt.Unix())]; ok {
+		t.Error("expected the check keyed by seconds to be moved")
+	}
+	if _, ok := migrated["uptime.1.public.TCP"]; ok {
+		t.Error("expected the lifetime uptime counter to be removed")
+	}
+	value, ok := migrated[string(checkKey("1", models.NetworkPublic, models.CheckTCP, checkedAt))]
+	if !ok {
+		t.Fatal("expected the check keyed by nanoseconds")
+	}
+	if value[0] == '{' {
+		t.Error("expected the check encoded as msgpack")
+	}
+
+	page, err := b.QueryChecks(models.CheckQuery{HostID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Checks) != 1 || page.Checks[0].ID != "check-1" || !page.Checks[0].CheckedAt.Equal(checkedAt) {
+		t.Errorf("expected the migrated check, got %+v", page.Checks)
+	}
+
+	// Migrating a current database changes nothing
+	if err := b.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+	assertSnapshot(t, "rerun", snapshot(t, b), migrated)
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	b, done := newTestBadger(t)
+	defer done()
+
+	if err := b.apply(nil, SchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Migrate(false); err == nil {
+		t.Error("expected a database newer than this version to be refused")
+	}
+}
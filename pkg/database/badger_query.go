@@ -0,0 +1,123 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/dgraph-io/badger"
+)
+
+// checkSeriesPrefix is the prefix of the checks of one type on one network of a host
+func checkSeriesPrefix(hostID string, network models.Network, checkType models.CheckType) []byte {
+	return []byte(fmt.Sprintf("checks.%s.%s.%s.", hostID, network, checkType))
+}
+
+func (b *Badger) QueryChecks(q models.CheckQuery) (*models.CheckPage, error) {
+	hostIDs := []string{q.HostID}
+	if q.HostID == "" {
+		hosts, err := b.GetHosts()
+		if err != nil {
+			return nil, err
+		}
+
+		hostIDs = hostIDs[:0]
+		for _, h := range hosts {
+			hostIDs = append(hostIDs, h.ID)
+		}
+	}
+
+	var checks []models.Check
+	err := b.db.View(func(txn *badger.Txn) error {
+		for _, hostID := range hostIDs {
+			for _, s := range checkSeries(txn, hostID) {
+				if (q.Network != "" && s.network != q.Network) || (q.CheckType != "" && s.checkType != q.CheckType) {
+					continue
+				}
+
+				found, err := queryCheckSeries(txn, hostID, s, q)
+				if err != nil {
+					return err
+				}
+				checks = append(checks, found...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Page(checks), nil
+}
+
+// checkSeries returns every network and check type the host has been checked on from its latest checks
+func checkSeries(txn *badger.Txn, hostID string) []series {
+	it := txn.NewIterator(badger.IteratorOptions{})
+	defer it.Close()
+
+	var found []series
+	prefix := latestChecksPrefix(hostID)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		// checks.<host id>.latest.<network>.<type>
+		keyParts := strings.Split(string(it.Item().Key()), ".")
+		if len(keyParts) != 5 {
+			continue
+		}
+		found = append(found, series{network: models.Network(keyParts[3]), checkType: models.CheckType(keyParts[4])})
+	}
+	return found
+}
+
+// queryCheckSeries range scans the time ordered keys of one series from the start of the
+// query. At most a page plus one of matches is read, which is enough to know if the
+// merged page of all series has a next page.
+func queryCheckSeries(txn *badger.Txn, hostID string, s series, q models.CheckQuery) ([]models.Check, error) {
+	var checks []models.Check
+	limit := q.PageLimit() + 1
+	err := scanCheckSeries(txn, hostID, s, q.From(), q.End, func(check models.Check) bool {
+		if q.Match(check) {
+			checks = append(checks, check)
+		}
+		return len(checks) < limit
+	})
+	return checks, err
+}
+
+// scanCheckSeries calls fn with the checks of one series from start until end, or until fn
+// returns false. The range is found by the timestamp in the keys, so only the checks in it
+// are read.
+func scanCheckSeries(txn *badger.Txn, hostID string, s series, start, end time.Time, fn func(models.Check) bool) error {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := checkSeriesPrefix(hostID, s.network, s.checkType)
+	seek := prefix
+	if !start.IsZero() {
+		seek = checkKey(hostID, s.network, s.checkType, start)
+	}
+
+	for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+		// Stop at the end of the range by the timestamp in the key before reading the value
+		key := string(it.Item().Key())
+		checkedAt, parseErr := strconv.ParseInt(key[len(prefix):], 10, 64)
+		if parseErr == nil && !end.IsZero() && !time.Unix(0, checkedAt).Before(end) {
+			break
+		}
+
+		var check models.Check
+		err := it.Item().Value(func(val []byte) error {
+			return decodeCheck(val, &check)
+		})
+		if err != nil {
+			return err
+		}
+
+		if !fn(check) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/dgraph-io/badger"
+)
+
+// mergePlan collects the writes that move the keys of duplicate hosts into one host.
+// Values written earlier in the plan are merged with as if they were already stored.
+type mergePlan struct {
+	txn     *badger.Txn
+	changes map[string]keyChange
+}
+
+// mergeFunc merges the incoming value into the existing value of the key, which is nil when the key is new
+type mergeFunc func(existing, incoming []byte) ([]byte, error)
+
+// prefixMove is a prefix followed by the host id and how values under it are merged
+type prefixMove struct {
+	prefix string
+	merge  mergeFunc
+}
+
+func (p *mergePlan) get(key []byte) ([]byte, uint64, error) {
+	if c, ok := p.changes[string(key)]; ok {
+		return c.value, c.expiresAt, nil
+	}
+
+	item, err := p.txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	val, err := item.ValueCopy(nil)
+	return val, item.ExpiresAt(), err
+}
+
+func (p *mergePlan) set(c keyChange) {
+	p.changes[string(c.key)] = c
+}
+
+// move rewrites every key under from to the same key under into
+func (p *mergePlan) move(from, into []byte, merge mergeFunc) error {
+	it := p.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Seek(from); it.ValidForPrefix(from); it.Next() {
+		item := it.Item()
+		incoming, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		key := append(append([]byte{}, into...), item.Key()[len(from):]...)
+		existing, expiresAt, err := p.get(key)
+		if err != nil {
+			return err
+		}
+
+		value, err := merge(existing, incoming)
+		if err != nil {
+			return err
+		}
+
+		// Keep the key as long as the longest lived of the values, 0 never expires
+		switch {
+		case existing == nil, item.ExpiresAt() == 0:
+			expiresAt = item.ExpiresAt()
+		case expiresAt != 0 && item.ExpiresAt() > expiresAt:
+			expiresAt = item.ExpiresAt()
+		}
+
+		p.set(keyChange{key: key, value: value, expiresAt: expiresAt})
+		p.set(keyChange{key: item.KeyCopy(nil)})
+	}
+	return nil
+}
+
+// repoint moves the index entries under prefix from the duplicate to the host
+func (p *mergePlan) repoint(prefix []byte, fromID, intoID string) error {
+	it := p.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		id, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if string(id) == fromID {
+			p.set(keyChange{key: it.Item().KeyCopy(nil), value: []byte(intoID)})
+		}
+	}
+	return nil
+}
+
+// MergeHosts moves the checks, uptime, inbound view, reflexive observations, rollups and
+// index entries of the duplicates into the host, removes the duplicates and saves the host.
+// It runs on the writer so no checks are counted between planning and writing the merge.
+func (b *Badger) MergeHosts(into *models.Host, duplicates []string) error {
+	return b.writer.exclusive(func() error {
+		return b.mergeHosts(into, duplicates)
+	})
+}
+
+func (b *Badger) mergeHosts(into *models.Host, duplicates []string) error {
+	var changes []keyChange
+	err := b.db.View(func(txn *badger.Txn) error {
+		p := &mergePlan{txn: txn, changes: make(map[string]keyChange)}
+		for _, id := range duplicates {
+			if id == into.ID || id == models.CurrentHostID {
+				continue
+			}
+
+			moves := []prefixMove{
+				{"checks.", mergeCheck(into.ID)},
+				{"uptime.", mergeUptime},
+				{inboundPrefix, mergeInbound},
+				{reflexivePrefix, mergeReflexive(into.ID)},
+			}
+			for _, resolution := range models.Resolutions {
+				moves = append(moves, prefixMove{"rollups." + string(resolution) + ".", mergeRollup(into.ID)})
+			}
+
+			for _, m := range moves {
+				if err := p.move([]byte(m.prefix+id+"."), []byte(m.prefix+into.ID+"."), m.merge); err != nil {
+					return err
+				}
+			}
+
+			for _, prefix := range []string{hostnamePrefix, ipPrefix} {
+				if err := p.repoint([]byte(prefix), id, into.ID); err != nil {
+					return err
+				}
+			}
+			p.set(keyChange{key: []byte(hostsPrefix + id)})
+		}
+
+		for _, c := range p.changes {
+			changes = append(changes, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := b.writeChanges(changes); err != nil {
+		return err
+	}
+	return b.SaveHost(into)
+}
+
+func mergeCheck(hostID string) mergeFunc {
+	return func(existing, incoming []byte) ([]byte, error) {
+		var check models.Check
+		if err := decodeCheck(incoming, &check); err != nil {
+			return nil, err
+		}
+
+		// Only the latest check shares a key, keep the most recent
+		if existing != nil {
+			var current models.Check
+			if err := decodeCheck(existing, &current); err != nil {
+				return nil, err
+			}
+			if current.CheckedAt.After(check.CheckedAt) {
+				return existing, nil
+			}
+		}
+
+		check.HostID = hostID
+		return encodeCheck(&check)
+	}
+}
+
+func mergeUptime(existing, incoming []byte) ([]byte, error) {
+	var bucket models.UptimeBucket
+	if err := json.Unmarshal(incoming, &bucket); err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		var current models.UptimeBucket
+		if err := json.Unmarshal(existing, &current); err != nil {
+			return nil, err
+		}
+		bucket.Merge(current)
+	}
+	return json.Marshal(bucket)
+}
+
+func mergeInbound(existing, incoming []byte) ([]byte, error) {
+	var stats models.InboundStats
+	if err := json.Unmarshal(incoming, &stats); err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		var current models.InboundStats
+		if err := json.Unmarshal(existing, &current); err != nil {
+			return nil, err
+		}
+		stats.Merge(current)
+	}
+	return json.Marshal(stats)
+}
+
+func mergeReflexive(hostID string) mergeFunc {
+	return func(existing, incoming []byte) ([]byte, error) {
+		var o models.ReflexiveObservation
+		if err := json.Unmarshal(incoming, &o); err != nil {
+			return nil, err
+		}
+
+		if existing != nil {
+			var current models.ReflexiveObservation
+			if err := json.Unmarshal(existing, &current); err != nil {
+				return nil, err
+			}
+			if current.ObservedAt.After(o.ObservedAt) {
+				return existing, nil
+			}
+		}
+
+		o.HostID = hostID
+		return json.Marshal(o)
+	}
+}
+
+func mergeRollup(hostID string) mergeFunc {
+	return func(existing, incoming []byte) ([]byte, error) {
+		var r models.Rollup
+		if err := json.Unmarshal(incoming, &r); err != nil {
+			return nil, err
+		}
+
+		if existing != nil {
+			var current models.Rollup
+			if err := json.Unmarshal(existing, &current); err != nil {
+				return nil, err
+			}
+			current.Merge(r)
+			r = current
+		}
+
+		r.HostID = hostID
+		return json.Marshal(r)
+	}
+}
+
+// CleanIndexes removes hostname and ip index entries of hosts that no longer exist or
+// no longer have the hostname. Ip entries are moved to the host that now has the address.
+// Entries for addresses a host was only discovered at are kept.
+func (b *Badger) CleanIndexes() (removed, moved int, err error) {
+	hosts, err := b.GetHosts()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	byID := make(map[string]models.Host)
+	hostnames := make(map[string]models.Host)
+	addrs := make(map[string]models.Host)
+	for _, h := range hosts {
+		byID[h.ID] = h
+		if other, ok := hostnames[h.Hostname]; !ok || h.LastSeenAt.After(other.LastSeenAt) {
+			hostnames[h.Hostname] = h
+		}
+		for _, addr := range h.NetworkAddresses() {
+			if other, ok := addrs[addr]; !ok || h.LastSeenAt.After(other.LastSeenAt) {
+				addrs[addr] = h
+			}
+		}
+	}
+
+	var changes []keyChange
+	err = b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for _, prefix := range [][]byte{[]byte(hostnamePrefix), []byte(ipPrefix)} {
+			isIP := bytes.Equal(prefix, []byte(ipPrefix))
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				key := it.Item().KeyCopy(nil)
+				value := string(key[len(prefix):])
+
+				id, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				host, exists := byID[string(id)]
+
+				var owner models.Host
+				var hasOwner bool
+				if isIP {
+					owner, hasOwner = addrs[value]
+					if exists && (host.HasIP(value) || !hasOwner) {
+						continue
+					}
+				} else {
+					owner, hasOwner = hostnames[value]
+					if exists && host.Hostname == value {
+						continue
+					}
+				}
+
+				if hasOwner && owner.ID != string(id) {
+					changes = append(changes, keyChange{key: key, value: []byte(owner.ID)})
+					moved++
+					continue
+				}
+				changes = append(changes, keyChange{key: key})
+				removed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return removed, moved, b.writeChanges(changes)
+}
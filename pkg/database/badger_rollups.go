@@ -0,0 +1,129 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/dgraph-io/badger"
+)
+
+const rollupWatermarkPrefix = "rollupwatermark."
+
+// rollups.<resolution>.<host id>.<network>.<type>.<unix start>
+func rollupKey(r models.Rollup) []byte {
+	return []byte(fmt.Sprintf("rollups.%s.%s.%s.%s.%d", r.Resolution, r.HostID, r.Network, r.CheckType, r.Start.Unix()))
+}
+
+// rollupsPrefix returns the prefix for the rollups of a host, or every host when hostID is empty
+func rollupsPrefix(resolution models.Resolution, hostID string) []byte {
+	if hostID == "" {
+		return []byte(fmt.Sprintf("rollups.%s.", resolution))
+	}
+	return []byte(fmt.Sprintf("rollups.%s.%s.", resolution, hostID))
+}
+
+// GetChecksBetween range scans the time ordered keys of every series of every host from
+// start to end, so only the checks in the range are read
+func (b *Badger) GetChecksBetween(start, end time.Time) ([]models.Check, error) {
+	hosts, err := b.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	var checks []models.Check
+	err = b.db.View(func(txn *badger.Txn) error {
+		for _, h := range hosts {
+			for _, s := range checkSeries(txn, h.ID) {
+				err := scanCheckSeries(txn, h.ID, s, start, end, func(check models.Check) bool {
+					checks = append(checks, check)
+					return true
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return checks, nil
+}
+
+func (b *Badger) SaveRollups(rollups []models.Rollup, retention time.Duration) error {
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, r := range rollups {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+
+		if err := wb.SetEntry(badger.NewEntry(rollupKey(r), data).WithTTL(retention)); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+func (b *Badger) GetRollups(filter models.RollupFilter) ([]models.Rollup, error) {
+	var rollups []models.Rollup
+	err := b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{})
+		defer it.Close()
+
+		prefix := rollupsPrefix(filter.Resolution, filter.HostID)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			// Skip windows outside the range by the start in the key before reading the value
+			key := string(it.Item().Key())
+			start, parseErr := strconv.ParseInt(key[strings.LastIndex(key, ".")+1:], 10, 64)
+			if parseErr == nil && !filter.MatchStart(time.Unix(start, 0)) {
+				continue
+			}
+
+			var r models.Rollup
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &r)
+			})
+			if err != nil {
+				return err
+			}
+
+			if filter.Match(r) {
+				rollups = append(rollups, r)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	models.SortRollups(rollups)
+	return rollups, nil
+}
+
+func (b *Badger) GetRollupWatermark(resolution models.Resolution) (time.Time, error) {
+	var t time.Time
+	err := b.db.View(func(txn *badger.Txn) error {
+		return getJSON(txn, []byte(rollupWatermarkPrefix+string(resolution)), &t)
+	})
+	if err != nil && err != ErrNotFound {
+		return time.Time{}, err
+	}
+	return t, nil
+}
+
+func (b *Badger) SetRollupWatermark(resolution models.Resolution, t time.Time) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		data, _ := json.Marshal(t)
+		return txn.Set([]byte(rollupWatermarkPrefix+string(resolution)), data)
+	})
+}
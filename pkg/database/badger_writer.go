@@ -0,0 +1,305 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/dgraph-io/badger"
+)
+
+const (
+	// writeQueueSize is how many checks and inbound probes can wait to be written before callers block
+	writeQueueSize = 4096
+
+	// maxWriteBatch limits how many queued writes are committed in one transaction
+	maxWriteBatch = 512
+
+	// maxWriteAttempts is how often a batch is retried when it conflicts with another transaction
+	maxWriteAttempts = 5
+)
+
+var (
+	errWriterClosed = errors.New("database writer is closed")
+	errReadOnly     = errors.New("database is opened read-only")
+)
+
+// Pipelined is a Store that queues writes for a single writer
+type Pipelined interface {
+	WriterStats() WriterStats
+}
+
+// WriterStats is the depth of the write queue and how its batches are being written
+type WriterStats struct {
+	QueueDepth        int
+	QueueCapacity     int
+	Batches           uint64
+	Writes            uint64
+	Conflicts         uint64
+	Errors            uint64
+	LastBatchSize     uint64
+	LastBatchDuration time.Duration
+}
+
+// writeRequest is a check or an inbound probe of a host waiting to be written, or a job
+// that has to run without any batch being written at the same time
+type writeRequest struct {
+	hostID string
+	check  *models.Check
+
+	inboundType  models.CheckType
+	inboundBytes int
+
+	job    func() error
+	result chan error
+}
+
+// writer commits the checks and inbound probes of every worker from one goroutine. Each
+// batch is one transaction that reads the counters once and adds every queued write to
+// them, so concurrent workers can't conflict and lose counts.
+type writer struct {
+	db    *badger.DB
+	queue chan writeRequest
+	done  chan struct{}
+
+	// mu guards sends against the queue being closed
+	mu     sync.RWMutex
+	closed bool
+
+	batches           uint64
+	writes            uint64
+	conflicts         uint64
+	errors            uint64
+	lastBatchSize     uint64
+	lastBatchDuration int64
+}
+
+func newWriter(db *badger.DB) *writer {
+	w := &writer{
+		db:    db,
+		queue: make(chan writeRequest, writeQueueSize),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// enqueue waits for room in the queue when the writer is behind. A database opened
+// read-only has no writer.
+func (w *writer) enqueue(req writeRequest) error {
+	if w == nil {
+		return errReadOnly
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return errWriterClosed
+	}
+	w.queue <- req
+	return nil
+}
+
+// exclusive runs the job on the writer after everything queued before it is written, so
+// reads and writes of counters in the job can't interleave with a batch and lose counts
+func (w *writer) exclusive(job func() error) error {
+	result := make(chan error, 1)
+	if err := w.enqueue(writeRequest{job: job, result: result}); err != nil {
+		return err
+	}
+	return <-result
+}
+
+// close writes everything still queued and stops the writer
+func (w *writer) close() {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	<-w.done
+}
+
+func (w *writer) stats() WriterStats {
+	if w == nil {
+		return WriterStats{}
+	}
+	return WriterStats{
+		QueueDepth:        len(w.queue),
+		QueueCapacity:     cap(w.queue),
+		Batches:           atomic.LoadUint64(&w.batches),
+		Writes:            atomic.LoadUint64(&w.writes),
+		Conflicts:         atomic.LoadUint64(&w.conflicts),
+		Errors:            atomic.LoadUint64(&w.errors),
+		LastBatchSize:     atomic.LoadUint64(&w.lastBatchSize),
+		LastBatchDuration: time.Duration(atomic.LoadInt64(&w.lastBatchDuration)),
+	}
+}
+
+// run batches everything that queued up while the previous batch was being written
+func (w *writer) run() {
+	defer close(w.done)
+
+	for req := range w.queue {
+		if req.job != nil {
+			req.result <- req.job()
+			continue
+		}
+		batch := []writeRequest{req}
+
+		// A job stops the batch so it runs after the writes queued before it
+		var job *writeRequest
+	collect:
+		for len(batch) < maxWriteBatch {
+			select {
+			case next, ok := <-w.queue:
+				if !ok {
+					break collect
+				}
+				if next.job != nil {
+					job = &next
+					break collect
+				}
+				batch = append(batch, next)
+			default:
+				break collect
+			}
+		}
+
+		w.write(batch)
+		if job != nil {
+			job.result <- job.job()
+		}
+	}
+}
+
+func (w *writer) write(batch []writeRequest) {
+	start := time.Now()
+
+	var err error
+	for attempt := 0; attempt < maxWriteAttempts; attempt++ {
+		err = w.db.Update(func(txn *badger.Txn) error {
+			return writeBatch(txn, batch)
+		})
+		if err != badger.ErrConflict {
+			break
+		}
+		atomic.AddUint64(&w.conflicts, 1)
+	}
+
+	// Split batches that fail, whether they don't fit in a transaction, keep conflicting or
+	// have a write that can't be stored, so only the writes that fail on their own are lost
+	if err != nil && len(batch) > 1 {
+		w.write(batch[:len(batch)/2])
+		w.write(batch[len(batch)/2:])
+		return
+	}
+
+	if err != nil {
+		atomic.AddUint64(&w.errors, 1)
+		log.Printf("error writing check or inbound probe of host %s: %v", batch[0].hostID, err)
+	} else {
+		atomic.AddUint64(&w.writes, uint64(len(batch)))
+	}
+	atomic.AddUint64(&w.batches, 1)
+	atomic.StoreUint64(&w.lastBatchSize, uint64(len(batch)))
+	atomic.StoreInt64(&w.lastBatchDuration, int64(time.Since(start)))
+}
+
+// writeBatch stores the checks, makes each the latest of its series and adds the checks and
+// inbound probes to their counters. Counters are read once and written once per batch.
+func writeBatch(txn *badger.Txn, batch []writeRequest) error {
+	uptime := make(map[string]*models.UptimeBucket)
+	inbound := make(map[string]*models.InboundStats)
+	latest := make(map[string]*models.Check)
+
+	for _, req := range batch {
+		if req.check == nil {
+			key := inboundKey(req.hostID, req.inboundType)
+			stats, ok := inbound[string(key)]
+			if !ok {
+				stats = &models.InboundStats{}
+				if err := getJSON(txn, key, stats); err != nil && err != ErrNotFound {
+					return err
+				}
+				inbound[string(key)] = stats
+			}
+			stats.Add(req.inboundBytes)
+			continue
+		}
+
+		check := req.check
+		data, err := encodeCheck(check)
+		if err != nil {
+			return err
+		}
+		entry := badger.NewEntry(checkKey(req.hostID, check.Network, check.CheckType, check.CheckedAt), data).WithTTL(checkTTL)
+		if err := txn.SetEntry(entry); err != nil {
+			return err
+		}
+
+		key := string(latestCheckKey(req.hostID, check.Network, check.CheckType))
+		if prev, ok := latest[key]; !ok || check.CheckedAt.After(prev.CheckedAt) {
+			latest[key] = check
+		}
+
+		for _, bucket := range models.UptimeBuckets(check) {
+			key := uptimeKey(req.hostID, bucket)
+			counts, ok := uptime[string(key)]
+			if !ok {
+				counts = &models.UptimeBucket{}
+				*counts = bucket
+				if err := getJSON(txn, key, counts); err != nil && err != ErrNotFound {
+					return err
+				}
+				uptime[string(key)] = counts
+			}
+			counts.Add(check)
+		}
+	}
+
+	for key, check := range latest {
+		data, err := encodeCheck(check)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set([]byte(key), data); err != nil {
+			return err
+		}
+	}
+
+	// Buckets expire once they are older than the longest window they are used for
+	for key, bucket := range uptime {
+		data, err := json.Marshal(bucket)
+		if err != nil {
+			return err
+		}
+
+		ttl := bucket.Retention() - time.Since(bucket.Start)
+		if err := txn.SetEntry(badger.NewEntry([]byte(key), data).WithTTL(ttl)); err != nil {
+			return err
+		}
+	}
+
+	for key, stats := range inbound {
+		data, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set([]byte(key), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
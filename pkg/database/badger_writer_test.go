@@ -0,0 +1,124 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+func TestWriterConcurrent(t *testing.T) {
+	b, cleanup := newTestBadger(t)
+	defer cleanup()
+
+	const workers, checks = 8, 50
+
+	// Each worker checks its own host like the checker's pool, so the checks of a host don't
+	// share a timestamp. Every check updates the same uptime counters of its host.
+	var hosts []*models.Host
+	for i := 0; i < workers; i++ {
+		h := newTestHost(fmt.Sprintf("node-%d", i), fmt.Sprintf("203.0.113.%d", i+1))
+		if err := b.SaveHost(h); err != nil {
+			t.Fatal(err)
+		}
+		hosts = append(hosts, h)
+	}
+
+	var wg sync.WaitGroup
+	for _, h := range hosts {
+		wg.Add(1)
+		go func(h *models.Host) {
+			defer wg.Done()
+			for i := 0; i < checks; i++ {
+				check := &models.Check{CheckType: models.CheckTCP, Network: models.NetworkPublic, Status: models.StatusSuccess}
+				if err := b.AddCheck(h, check); err != nil {
+					t.Error(err)
+				}
+			}
+		}(h)
+	}
+	wg.Wait()
+
+	eventually(t, func() bool {
+		return b.WriterStats().Writes == workers*checks
+	})
+
+	stats := b.WriterStats()
+	if stats.Errors != 0 || stats.QueueDepth != 0 {
+		t.Errorf("expected every write to succeed and the queue to be empty, got %+v", stats)
+	}
+	if stats.Batches == 0 || stats.Batches > workers*checks {
+		t.Errorf("expected between 1 and %d batches, got %d", workers*checks, stats.Batches)
+	}
+
+	for _, h := range hosts {
+		page, err := b.QueryChecks(models.CheckQuery{HostID: h.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Checks) != checks {
+			t.Errorf("expected %d checks of %s, got %d", checks, h.Hostname, len(page.Checks))
+		}
+
+		got, err := b.GetHostByID(h.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total := got.CheckUptime.Windows["1h"].TotalChecks; total != checks {
+			t.Errorf("expected the uptime of %s to count %d checks, got %d", h.Hostname, checks, total)
+		}
+	}
+}
+
+func TestOpenBadgerReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service_tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := NewBadger(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := newTestHost("node-1", "203.0.113.1")
+	if err := b.SaveHost(host); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := OpenBadgerReadOnly(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+
+	if ro.writer != nil {
+		t.Error("expected no writer to be started")
+	}
+	if _, err := ro.GetHostByID(host.ID); err != nil {
+		t.Errorf("expected the host to be read, got %v", err)
+	}
+
+	check := &models.Check{CheckType: models.CheckTCP, Network: models.NetworkPublic, Status: models.StatusSuccess}
+	if err := ro.AddCheck(host, check); err != errReadOnly {
+		t.Errorf("expected adding a check to fail, got %v", err)
+	}
+	if err := ro.RecordInbound(host, models.CheckTCP, 10); err != errReadOnly {
+		t.Errorf("expected recording an inbound probe to fail, got %v", err)
+	}
+	if err := ro.MergeHosts(host, []string{"other"}); err != errReadOnly {
+		t.Errorf("expected merging hosts to fail, got %v", err)
+	}
+	if err := ro.SaveHost(host); err == nil {
+		t.Error("expected saving a host to fail")
+	}
+	if stats := ro.WriterStats(); stats.Writes != 0 || stats.QueueCapacity != 0 {
+		t.Errorf("expected empty writer stats, got %+v", stats)
+	}
+}
@@ -1,4 +1,179 @@
 package database
 
-type DB interface {
+import (
+	"errors"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/config"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// checkTTL is how long individual checks are kept
+const checkTTL = 1 * time.Hour
+
+// ErrNotFound is returned when a host or record does not exist
+var ErrNotFound = errors.New("not found")
+
+// Store persists hosts, their checks and uptime, and the current host
+type Store interface {
+	// GetHosts returns every known host except the current host sorted by hostname
+	GetHosts() ([]models.Host, error)
+	// GetHostsWithStatuses returns every host with its latest checks, uptime and inbound view
+	GetHostsWithStatuses() ([]models.Host, error)
+	// GetHostByID returns the host with all of its checks, uptime and inbound view
+	GetHostByID(id string) (*models.Host, error)
+	GetHostByHostname(hostname string) (*models.Host, error)
+	GetHostByIP(ip string) (*models.Host, error)
+	// SaveHost stores the host and indexes it by hostname and each of its addresses
+	SaveHost(host *models.Host) error
+	// SetIPOwner points the ip index at the host. Used when a different host than
+	// the indexed one is found answering on the address.
+	SetIPOwner(host *models.Host, ip string) error
+
+	// MergeHosts moves everything stored for the duplicate hosts into the host, points their
+	// index entries at it, removes them and saves the host
+	MergeHosts(into *models.Host, duplicates []string) error
+	// CleanIndexes removes or moves hostname and ip index entries that point at the wrong host
+	CleanIndexes() (removed, moved int, err error)
+
+	GetCurrentHost() (*models.Host, error)
+	SaveCurrentHost(host *models.Host) error
+
+	// AddCheck stores the check, makes it the latest for its network and type, and counts it towards the uptime.
+	// Stores may queue the write and store it shortly after.
+	AddCheck(host *models.Host, check *models.Check) error
+	// QueryChecks returns a page of the checks selected by the query
+	QueryChecks(q models.CheckQuery) (*models.CheckPage, error)
+	// ResetUptime clears the uptime of the host in every window
+	ResetUptime(hostID string) error
+
+	// RecordInbound counts a probe received from the host
+	RecordInbound(host *models.Host, checkType models.CheckType, bytes int) error
+
+	SaveReflexiveObservation(o *models.ReflexiveObservation) error
+	GetReflexiveObservations() ([]models.ReflexiveObservation, error)
+
+	// GetChecksBetween returns the checks of every host checked in [start, end)
+	GetChecksBetween(start, end time.Time) ([]models.Check, error)
+	// SaveRollups stores the rollups, replacing any for the same window, and keeps them for the retention
+	SaveRollups(rollups []models.Rollup, retention time.Duration) error
+	// GetRollups returns the rollups matching the filter sorted by start time. The filter must have a resolution.
+	GetRollups(filter models.RollupFilter) ([]models.Rollup, error)
+	// GetRollupWatermark returns the end of the last window rolled up at the resolution
+	GetRollupWatermark(resolution models.Resolution) (time.Time, error)
+	SetRollupWatermark(resolution models.Resolution, t time.Time) error
+
+	// SaveIncident stores the incident, replacing an earlier save, and keeps it for the retention
+	SaveIncident(i *models.Incident, retention time.Duration) error
+	// GetIncidents returns a page of the incidents matching the filter with the most recently started first
+	GetIncidents(filter models.IncidentFilter) (*models.IncidentPage, error)
+
+	// SaveEvent appends the event to the event log and keeps it for the retention
+	SaveEvent(e *models.Event, retention time.Duration) error
+	// GetEvents returns a page of the events matching the filter oldest first
+	GetEvents(filter models.EventFilter) (*models.EventPage, error)
+
+	Close() error
+}
+
+var (
+	_ Store = (*Badger)(nil)
+	_ Store = (*Memory)(nil)
+)
+
+// GetCurrentHost returns the current host with its service and host uptime
+func GetCurrentHost(s Store) (*models.Host, error) {
+	host, err := s.GetCurrentHost()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := host.SetCurrentUptimes(); err != nil {
+		return nil, err
+	}
+	return host, nil
+}
+
+// UpdateCurrentHost refreshes and stores the current host, creating it on first start
+func UpdateCurrentHost(s Store, conf *config.Config, init bool) error {
+	host, err := s.GetCurrentHost()
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	if host == nil {
+		host = models.NewCurrentHost(conf)
+	}
+
+	if err := host.RefreshCurrentHost(conf, init); err != nil {
+		return err
+	}
+
+	return s.SaveCurrentHost(host)
+}
+
+// GetReflexiveAddress returns the current host's address and NAT behavior as seen by its peers
+func GetReflexiveAddress(s Store, current *models.Host) (*models.ReflexiveAddress, error) {
+	observations, err := s.GetReflexiveObservations()
+	if err != nil {
+		return nil, err
+	}
+	return models.NewReflexiveAddress(observations, current), nil
+}
+
+// SetLatency sets the latency percentiles of the host for the last hour and day. The last
+// hour comes from minute rollups, the last day from hour rollups plus the minute rollups
+// since the last hour was rolled up.
+func SetLatency(s Store, h *models.Host) error {
+	now := time.Now().UTC()
+	lastHour := now.Add(-time.Hour)
+	lastDay := now.Add(-24 * time.Hour)
+
+	hourMark, err := s.GetRollupWatermark(models.ResolutionHour)
+	if err != nil {
+		return err
+	}
+	if hourMark.Before(lastDay) {
+		hourMark = lastDay
+	}
+
+	minuteStart := hourMark
+	if lastHour.Before(minuteStart) {
+		minuteStart = lastHour
+	}
+
+	minutes, err := s.GetRollups(models.RollupFilter{
+		HostID:     h.ID,
+		Resolution: models.ResolutionMinute,
+		Start:      minuteStart,
+	})
+	if err != nil {
+		return err
+	}
+
+	hours, err := s.GetRollups(models.RollupFilter{
+		HostID:     h.ID,
+		Resolution: models.ResolutionHour,
+		Start:      lastDay,
+		End:        hourMark,
+	})
+	if err != nil {
+		return err
+	}
+
+	b := models.NewLatencyBuilder()
+	for _, r := range minutes {
+		if !r.Start.Before(lastHour) {
+			b.Add("1h", r)
+		}
+		if !r.Start.Before(hourMark) {
+			b.Add("24h", r)
+		}
+	}
+	for _, r := range hours {
+		b.Add("24h", r)
+	}
+
+	h.Latency = b.Build()
+	return nil
 }
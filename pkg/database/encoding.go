@@ -0,0 +1,87 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/vmihailenco/msgpack"
+)
+
+// checkEncodingV1 is the first byte of checks encoded as storedCheck in msgpack. Values
+// starting with '{' are checks stored as json before the envelope existed.
+const checkEncodingV1 byte = 1
+
+// storedCheck is the msgpack layout of a check with short field names and times as integers
+type storedCheck struct {
+	ID                string `msgpack:"i,omitempty"`
+	HostID            string `msgpack:"h,omitempty"`
+	Status            string `msgpack:"s,omitempty"`
+	ResponseTime      int64  `msgpack:"r,omitempty"`
+	StatusCode        int    `msgpack:"c,omitempty"`
+	ResponseBody      string `msgpack:"b,omitempty"`
+	CheckErrorMessage string `msgpack:"e,omitempty"`
+	Network           string `msgpack:"n,omitempty"`
+	SourceIP          string `msgpack:"si,omitempty"`
+	SourceInterface   string `msgpack:"sf,omitempty"`
+	CheckType         string `msgpack:"t,omitempty"`
+	CheckedAt         int64  `msgpack:"at,omitempty"`
+}
+
+// encodeCheck encodes the check in the current envelope version
+func encodeCheck(c *models.Check) ([]byte, error) {
+	data, err := msgpack.Marshal(&storedCheck{
+		ID:                c.ID,
+		HostID:            c.HostID,
+		Status:            string(c.Status),
+		ResponseTime:      int64(c.ResponseTime),
+		StatusCode:        c.StatusCode,
+		ResponseBody:      c.ResponseBody,
+		CheckErrorMessage: c.CheckErrorMessage,
+		Network:           string(c.Network),
+		SourceIP:          c.SourceIP,
+		SourceInterface:   c.SourceInterface,
+		CheckType:         string(c.CheckType),
+		CheckedAt:         c.CheckedAt.UnixNano(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{checkEncodingV1}, data...), nil
+}
+
+// decodeCheck decodes a check in any envelope version
+func decodeCheck(data []byte, c *models.Check) error {
+	if len(data) == 0 {
+		return fmt.Errorf("empty check value")
+	}
+
+	switch data[0] {
+	case '{':
+		return json.Unmarshal(data, c)
+	case checkEncodingV1:
+		var s storedCheck
+		if err := msgpack.Unmarshal(data[1:], &s); err != nil {
+			return err
+		}
+
+		*c = models.Check{
+			ID:                s.ID,
+			HostID:            s.HostID,
+			Status:            models.Status(s.Status),
+			ResponseTime:      time.Duration(s.ResponseTime),
+			StatusCode:        s.StatusCode,
+			ResponseBody:      s.ResponseBody,
+			CheckErrorMessage: s.CheckErrorMessage,
+			Network:           models.Network(s.Network),
+			SourceIP:          s.SourceIP,
+			SourceInterface:   s.SourceInterface,
+			CheckType:         models.CheckType(s.CheckType),
+			CheckedAt:         time.Unix(0, s.CheckedAt).UTC(),
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown check encoding version %d", data[0])
+	}
+}
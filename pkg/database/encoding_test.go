@@ -0,0 +1,105 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// benchCheck is a typical http check with the health of the peer as its response body
+var benchCheck = &models.Check{
+	ID:           "3f1d1c6e-6c4b-4a57-9a7e-2f0b7e6f4c11",
+	HostID:       "0b9f5f8e-2f8c-4d5b-8c0e-5b3a0f1e9d22",
+	Status:       models.StatusSuccess,
+	ResponseTime: 1234567,
+	StatusCode:   200,
+	ResponseBody: `{"id":"current-host","hostname":"node-1","instanceId":"a0c1e2d3","serviceFirstStart":"2020-06-01T00:00:00Z","serviceLastStart":"2020-06-01T00:00:00Z","internalIp":"10.0.0.1","publicIp":"203.0.113.1","serviceUptime":1000000000,"hostUptime":4055000000000,"observedAddr":"203.0.113.2:54376"}`,
+	Network:      models.NetworkPublic,
+	SourceIP:     "203.0.113.2",
+	CheckType:    models.CheckHTTP,
+	CheckedAt:    time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC),
+}
+
+func TestCheckEncoding(t *testing.T) {
+	data, err := encodeCheck(benchCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var check models.Check
+	if err := decodeCheck(data, &check); err != nil {
+		t.Fatal(err)
+	}
+	if check != *benchCheck {
+		t.Errorf("decoded check differs:\n got %+v\nwant %+v", check, *benchCheck)
+	}
+
+	// Checks stored as json before the envelope still decode
+	legacy, err := json.Marshal(benchCheck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check = models.Check{}
+	if err := decodeCheck(legacy, &check); err != nil {
+		t.Fatal(err)
+	}
+	if !check.CheckedAt.Equal(benchCheck.CheckedAt) || check.ResponseBody != benchCheck.ResponseBody {
+		t.Errorf("decoded json check differs: %+v", check)
+	}
+}
+
+func BenchmarkEncodeCheckMsgpack(b *testing.B) {
+	var size int
+	for i := 0; i < b.N; i++ {
+		data, err := encodeCheck(benchCheck)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "bytes/check")
+}
+
+func BenchmarkEncodeCheckJSON(b *testing.B) {
+	var size int
+	for i := 0; i < b.N; i++ {
+		data, err := json.Marshal(benchCheck)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size = len(data)
+	}
+	b.ReportMetric(float64(size), "bytes/check")
+}
+
+func BenchmarkDecodeCheckMsgpack(b *testing.B) {
+	data, err := encodeCheck(benchCheck)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var check models.Check
+		if err := decodeCheck(data, &check); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeCheckJSON(b *testing.B) {
+	data, err := json.Marshal(benchCheck)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var check models.Check
+		if err := json.Unmarshal(data, &check); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
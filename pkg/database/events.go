@@ -0,0 +1,38 @@
+package database
+
+import (
+	"log"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// EventLog records the events of the mesh in the store, keeping them for the retention
+type EventLog struct {
+	s         Store
+	retention time.Duration
+	listeners []func(*models.Event)
+}
+
+func NewEventLog(s Store, retention time.Duration) *EventLog {
+	return &EventLog{s: s, retention: retention}
+}
+
+// OnRecord calls f with every event recorded after it was saved. Listeners must be added
+// before the log is used.
+func (l *EventLog) OnRecord(f func(*models.Event)) {
+	l.listeners = append(l.listeners, f)
+}
+
+// Record saves the event, errors are logged as an event is never worth failing the caller for
+func (l *EventLog) Record(e *models.Event) {
+	log.Printf("event %s: %s", e.Type, e.Message)
+	if err := l.s.SaveEvent(e, l.retention); err != nil {
+		log.Printf("error saving event (%s): %v", e.Type, err)
+		return
+	}
+
+	for _, f := range l.listeners {
+		f(e)
+	}
+}
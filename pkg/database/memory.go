@@ -1 +1,453 @@
 package database
+
+import (
+	"sync"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// Memory is a Store kept in memory for tests and ephemeral runs. Nothing is kept after a restart.
+// Hosts are copied on save and load so callers never share their maps with the store.
+type Memory struct {
+	mu sync.RWMutex
+
+	hosts      map[string]models.Host
+	hostnames  map[string]string
+	ips        map[string]string
+	checks     map[string][]models.Check
+	latest     map[string]map[series]models.Check
+	uptime     map[string]map[uptimeSeries]models.UptimeBucket
+	inbound    map[string]map[models.CheckType]models.InboundStats
+	reflexive  map[reflexiveSeries]models.ReflexiveObservation
+	rollups    map[rollupSeries]expiringRollup
+	watermarks map[models.Resolution]time.Time
+	incidents  map[string]expiringIncident
+	events     []expiringEvent
+}
+
+// series identifies the checks of one type on one network
+type series struct {
+	network   models.Network
+	checkType models.CheckType
+}
+
+type reflexiveSeries struct {
+	hostID string
+	series
+}
+
+type uptimeSeries struct {
+	series
+	resolution models.Resolution
+	start      int64
+}
+
+type rollupSeries struct {
+	hostID string
+	series
+	resolution models.Resolution
+	start      int64
+}
+
+type expiringIncident struct {
+	models.Incident
+	expires time.Time
+}
+
+type expiringRollup struct {
+	models.Rollup
+	expires time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		hosts:      make(map[string]models.Host),
+		hostnames:  make(map[string]string),
+		ips:        make(map[string]string),
+		checks:     make(map[string][]models.Check),
+		latest:     make(map[string]map[series]models.Check),
+		uptime:     make(map[string]map[uptimeSeries]models.UptimeBucket),
+		inbound:    make(map[string]map[models.CheckType]models.InboundStats),
+		reflexive:  make(map[reflexiveSeries]models.ReflexiveObservation),
+		rollups:    make(map[rollupSeries]expiringRollup),
+		watermarks: make(map[models.Resolution]time.Time),
+		incidents:  make(map[string]expiringIncident),
+	}
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) GetHosts() ([]models.Host, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var hosts []models.Host
+	for id, host := range m.hosts {
+		if id == models.CurrentHostID {
+			continue
+		}
+		hosts = append(hosts, copyHost(host))
+	}
+
+	models.SortHosts(hosts)
+	return hosts, nil
+}
+
+func (m *Memory) GetHostsWithStatuses() ([]models.Host, error) {
+	hosts, err := m.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := range hosts {
+		m.addLatestStatuses(&hosts[i])
+		m.setUptimes(&hosts[i])
+		m.addInbound(&hosts[i])
+	}
+	return hosts, nil
+}
+
+func (m *Memory) GetHostByID(id string) (*models.Host, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.hosts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	host := copyHost(stored)
+	m.addLatestStatuses(&host)
+	m.addChecks(&host)
+	m.setUptimes(&host)
+	m.addInbound(&host)
+	return &host, nil
+}
+
+func (m *Memory) GetHostByHostname(hostname string) (*models.Host, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.getIndexed(m.hostnames, hostname)
+}
+
+func (m *Memory) GetHostByIP(ip string) (*models.Host, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.getIndexed(m.ips, ip)
+}
+
+func (m *Memory) getIndexed(index map[string]string, key string) (*models.Host, error) {
+	id, ok := index[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	host, ok := m.hosts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	host = copyHost(host)
+	return &host, nil
+}
+
+// copyHost copies the maps and pointers of the host so callers and the store don't share them
+func copyHost(h models.Host) models.Host {
+	if h.Addresses != nil {
+		addresses := make(map[models.Network]string, len(h.Addresses))
+		for network, addr := range h.Addresses {
+			addresses[network] = addr
+		}
+		h.Addresses = addresses
+	}
+	if h.Labels != nil {
+		labels := make(map[string]string, len(h.Labels))
+		for key, value := range h.Labels {
+			labels[key] = value
+		}
+		h.Labels = labels
+	}
+	if h.Restarts != nil {
+		restarts := *h.Restarts
+		h.Restarts = &restarts
+	}
+	return h
+}
+
+func (m *Memory) SaveHost(h *models.Host) error {
+	h.BeforeSave()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Remove the index entries for a hostname or addresses the host no longer has
+	if prev, ok := m.hosts[h.ID]; ok {
+		if prev.Hostname != h.Hostname && m.hostnames[prev.Hostname] == h.ID {
+			delete(m.hostnames, prev.Hostname)
+		}
+		for _, addr := range prev.NetworkAddresses() {
+			if !h.HasIP(addr) && addr != h.DiscoveredIP && m.ips[addr] == h.ID {
+				delete(m.ips, addr)
+			}
+		}
+	}
+
+	m.hosts[h.ID] = copyHost(*h)
+	m.hostnames[h.Hostname] = h.ID
+	for _, addr := range h.NetworkAddresses() {
+		m.ips[addr] = h.ID
+	}
+	if h.DiscoveredIP != "" {
+		m.ips[h.DiscoveredIP] = h.ID
+	}
+	return nil
+}
+
+func (m *Memory) SetIPOwner(h *models.Host, ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ips[ip] = h.ID
+	return nil
+}
+
+func (m *Memory) GetCurrentHost() (*models.Host, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	host, ok := m.hosts[models.CurrentHostID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	host = copyHost(host)
+	return &host, nil
+}
+
+func (m *Memory) SaveCurrentHost(h *models.Host) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hosts[h.ID] = copyHost(*h)
+	return nil
+}
+
+func (m *Memory) AddCheck(h *models.Host, check *models.Check) error {
+	check.Stamp(h)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.checks[h.ID] = append(m.expireChecks(h.ID), *check)
+
+	key := series{network: check.Network, checkType: check.CheckType}
+	if m.latest[h.ID] == nil {
+		m.latest[h.ID] = make(map[series]models.Check)
+	}
+	m.latest[h.ID][key] = *check
+
+	if m.uptime[h.ID] == nil {
+		m.uptime[h.ID] = make(map[uptimeSeries]models.UptimeBucket)
+	}
+	m.expireUptime(h.ID)
+	for _, bucket := range models.UptimeBuckets(check) {
+		key := uptimeSeries{series: key, resolution: bucket.Resolution, start: bucket.Start.Unix()}
+		if existing, ok := m.uptime[h.ID][key]; ok {
+			bucket = existing
+		}
+		bucket.Add(check)
+		m.uptime[h.ID][key] = bucket
+	}
+	return nil
+}
+
+// expireUptime drops the uptime buckets of the host that are no longer in any window
+func (m *Memory) expireUptime(hostID string) {
+	for key, bucket := range m.uptime[hostID] {
+		if time.Since(bucket.Start) > bucket.Retention() {
+			delete(m.uptime[hostID], key)
+		}
+	}
+}
+
+// expireChecks drops the checks of the host that are older than the check ttl
+func (m *Memory) expireChecks(hostID string) []models.Check {
+	checks := m.checks[hostID]
+	cutoff := time.Now().Add(-checkTTL)
+	for len(checks) > 0 && checks[0].CheckedAt.Before(cutoff) {
+		checks = checks[1:]
+	}
+	return checks
+}
+
+func (m *Memory) addChecks(h *models.Host) {
+	h.Checks = models.NewServiceChecks()
+	cutoff := time.Now().Add(-checkTTL)
+	for _, check := range m.checks[h.ID] {
+		if check.CheckedAt.Before(cutoff) {
+			continue
+		}
+		h.Checks.Network(check.Network).Add(check)
+	}
+}
+
+func (m *Memory) QueryChecks(q models.CheckQuery) (*models.CheckPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cutoff := time.Now().Add(-checkTTL)
+	var checks []models.Check
+	for hostID, hostChecks := range m.checks {
+		if hostID == models.CurrentHostID || (q.HostID != "" && hostID != q.HostID) {
+			continue
+		}
+
+		for _, check := range hostChecks {
+			if !check.CheckedAt.Before(cutoff) && q.Match(check) {
+				checks = append(checks, check)
+			}
+		}
+	}
+	return q.Page(checks), nil
+}
+
+func (m *Memory) addLatestStatuses(h *models.Host) {
+	h.LatestChecks = models.NewServiceChecks()
+	for key, check := range m.latest[h.ID] {
+		h.LatestChecks.Network(key.network).Set(check)
+	}
+}
+
+func (m *Memory) setUptimes(h *models.Host) {
+	now := time.Now()
+	h.CheckUptime = models.NewCheckUptime()
+	for _, bucket := range m.uptime[h.ID] {
+		h.CheckUptime.AddBucket(bucket, now)
+	}
+}
+
+func (m *Memory) ResetUptime(hostID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.uptime, hostID)
+	return nil
+}
+
+func (m *Memory) RecordInbound(h *models.Host, checkType models.CheckType, bytes int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.inbound[h.ID] == nil {
+		m.inbound[h.ID] = make(map[models.CheckType]models.InboundStats)
+	}
+	stats := m.inbound[h.ID][checkType]
+	stats.Add(bytes)
+	m.inbound[h.ID][checkType] = stats
+	return nil
+}
+
+func (m *Memory) addInbound(h *models.Host) {
+	h.Inbound = &models.InboundView{}
+	for checkType, stats := range m.inbound[h.ID] {
+		h.Inbound.Set(checkType, stats)
+	}
+}
+
+func (m *Memory) SaveReflexiveObservation(o *models.ReflexiveObservation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := reflexiveSeries{hostID: o.HostID, series: series{network: o.Network, checkType: o.CheckType}}
+	m.reflexive[key] = *o
+	return nil
+}
+
+func (m *Memory) GetReflexiveObservations() ([]models.ReflexiveObservation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var observations []models.ReflexiveObservation
+	cutoff := time.Now().Add(-checkTTL)
+	for _, o := range m.reflexive {
+		if o.ObservedAt.Before(cutoff) {
+			continue
+		}
+		observations = append(observations, o)
+	}
+	return observations, nil
+}
+
+func (m *Memory) GetChecksBetween(start, end time.Time) ([]models.Check, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var checks []models.Check
+	for _, hostChecks := range m.checks {
+		for _, check := range hostChecks {
+			if check.CheckedAt.Before(start) || !check.CheckedAt.Before(end) {
+				continue
+			}
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+func (m *Memory) SaveRollups(rollups []models.Rollup, retention time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expires := time.Now().Add(retention)
+	for _, r := range rollups {
+		key := rollupSeries{
+			hostID:     r.HostID,
+			series:     series{network: r.Network, checkType: r.CheckType},
+			resolution: r.Resolution,
+			start:      r.Start.Unix(),
+		}
+		m.rollups[key] = expiringRollup{Rollup: r, expires: expires}
+	}
+	return nil
+}
+
+func (m *Memory) GetRollups(filter models.RollupFilter) ([]models.Rollup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rollups []models.Rollup
+	now := time.Now()
+	for key, r := range m.rollups {
+		if now.After(r.expires) {
+			delete(m.rollups, key)
+			continue
+		}
+		if filter.Match(r.Rollup) {
+			rollups = append(rollups, r.Rollup)
+		}
+	}
+
+	models.SortRollups(rollups)
+	return rollups, nil
+}
+
+func (m *Memory) GetRollupWatermark(resolution models.Resolution) (time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.watermarks[resolution], nil
+}
+
+func (m *Memory) SetRollupWatermark(resolution models.Resolution, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.watermarks[resolution] = t
+	return nil
+}
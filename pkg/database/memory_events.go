@@ -0,0 +1,47 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+type expiringEvent struct {
+	models.Event
+	expires time.Time
+}
+
+func (m *Memory) SaveEvent(e *models.Event, retention time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, expiringEvent{Event: *e, expires: time.Now().Add(retention)})
+	sort.SliceStable(m.events, func(a, b int) bool {
+		if !m.events[a].At.Equal(m.events[b].At) {
+			return m.events[a].At.Before(m.events[b].At)
+		}
+		return m.events[a].ID < m.events[b].ID
+	})
+	return nil
+}
+
+func (m *Memory) GetEvents(filter models.EventFilter) (*models.EventPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var events []models.Event
+	for _, e := range m.events {
+		if len(events) > filter.PageLimit() {
+			break
+		}
+		if now.After(e.expires) || e.At.Before(filter.Start) || (!filter.End.IsZero() && !e.At.Before(filter.End)) {
+			continue
+		}
+		if filter.Match(e.Event) {
+			events = append(events, e.Event)
+		}
+	}
+	return filter.Page(events), nil
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+func (m *Memory) SaveIncident(i *models.Incident, retention time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.incidents[i.ID] = expiringIncident{Incident: *i, expires: time.Now().Add(retention)}
+	return nil
+}
+
+func (m *Memory) GetIncidents(filter models.IncidentFilter) (*models.IncidentPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var incidents []models.Incident
+	for _, i := range m.incidents {
+		if now.After(i.expires) || !filter.Match(i.Incident) {
+			continue
+		}
+		incidents = append(incidents, i.Incident)
+	}
+
+	return filter.Page(incidents), nil
+}
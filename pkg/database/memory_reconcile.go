@@ -0,0 +1,150 @@
+package database
+
+import (
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+func (m *Memory) MergeHosts(into *models.Host, duplicates []string) error {
+	m.mu.Lock()
+	for _, id := range duplicates {
+		if id == into.ID || id == models.CurrentHostID {
+			continue
+		}
+		m.mergeHost(into.ID, id)
+	}
+	m.mu.Unlock()
+
+	return m.SaveHost(into)
+}
+
+// mergeHost moves everything stored for the duplicate to the host
+func (m *Memory) mergeHost(intoID, fromID string) {
+	for _, check := range m.checks[fromID] {
+		check.HostID = intoID
+		m.checks[intoID] = append(m.checks[intoID], check)
+	}
+	models.SortChecks(m.checks[intoID])
+	delete(m.checks, fromID)
+
+	if m.latest[intoID] == nil {
+		m.latest[intoID] = make(map[series]models.Check)
+	}
+	for key, check := range m.latest[fromID] {
+		if current, ok := m.latest[intoID][key]; !ok || check.CheckedAt.After(current.CheckedAt) {
+			check.HostID = intoID
+			m.latest[intoID][key] = check
+		}
+	}
+	delete(m.latest, fromID)
+
+	if m.uptime[intoID] == nil {
+		m.uptime[intoID] = make(map[uptimeSeries]models.UptimeBucket)
+	}
+	for key, bucket := range m.uptime[fromID] {
+		if current, ok := m.uptime[intoID][key]; ok {
+			bucket.Merge(current)
+		}
+		m.uptime[intoID][key] = bucket
+	}
+	delete(m.uptime, fromID)
+
+	if m.inbound[intoID] == nil {
+		m.inbound[intoID] = make(map[models.CheckType]models.InboundStats)
+	}
+	for checkType, stats := range m.inbound[fromID] {
+		stats.Merge(m.inbound[intoID][checkType])
+		m.inbound[intoID][checkType] = stats
+	}
+	delete(m.inbound, fromID)
+
+	for key, o := range m.reflexive {
+		if key.hostID != fromID {
+			continue
+		}
+		delete(m.reflexive, key)
+
+		key.hostID = intoID
+		if current, ok := m.reflexive[key]; ok && current.ObservedAt.After(o.ObservedAt) {
+			continue
+		}
+		o.HostID = intoID
+		m.reflexive[key] = o
+	}
+
+	for key, r := range m.rollups {
+		if key.hostID != fromID {
+			continue
+		}
+		delete(m.rollups, key)
+
+		key.hostID = intoID
+		r.HostID = intoID
+		if current, ok := m.rollups[key]; ok {
+			current.Merge(r.Rollup)
+			if r.expires.After(current.expires) {
+				current.expires = r.expires
+			}
+			r = current
+		}
+		m.rollups[key] = r
+	}
+
+	for _, index := range []map[string]string{m.hostnames, m.ips} {
+		for key, id := range index {
+			if id == fromID {
+				index[key] = intoID
+			}
+		}
+	}
+	delete(m.hosts, fromID)
+}
+
+func (m *Memory) CleanIndexes() (removed, moved int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hostnames := make(map[string]models.Host)
+	addrs := make(map[string]models.Host)
+	for id, h := range m.hosts {
+		if id == models.CurrentHostID {
+			continue
+		}
+		if other, ok := hostnames[h.Hostname]; !ok || h.LastSeenAt.After(other.LastSeenAt) {
+			hostnames[h.Hostname] = h
+		}
+		for _, addr := range h.NetworkAddresses() {
+			if other, ok := addrs[addr]; !ok || h.LastSeenAt.After(other.LastSeenAt) {
+				addrs[addr] = h
+			}
+		}
+	}
+
+	for hostname, id := range m.hostnames {
+		if host, ok := m.hosts[id]; ok && host.Hostname == hostname {
+			continue
+		}
+		if owner, ok := hostnames[hostname]; ok {
+			m.hostnames[hostname] = owner.ID
+			moved++
+			continue
+		}
+		delete(m.hostnames, hostname)
+		removed++
+	}
+
+	for ip, id := range m.ips {
+		host, exists := m.hosts[id]
+		owner, hasOwner := addrs[ip]
+		if exists && (host.HasIP(ip) || !hasOwner) {
+			continue
+		}
+		if hasOwner {
+			m.ips[ip] = owner.ID
+			moved++
+			continue
+		}
+		delete(m.ips, ip)
+		removed++
+	}
+	return removed, moved, nil
+}
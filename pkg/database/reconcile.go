@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// Reconcile merges hosts that are records of the same node and cleans up index entries
+// left behind by hosts that changed hostname or address. Each merge is recorded in the event log.
+func Reconcile(s Store, events *EventLog) (*models.ReconcileReport, error) {
+	report := &models.ReconcileReport{
+		StartedAt: time.Now().UTC(),
+		Merged:    []models.MergedHost{},
+	}
+
+	hosts, err := s.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range models.FindDuplicates(hosts) {
+		host, duplicates := models.MergeDuplicates(group)
+		if err := s.MergeHosts(&host, duplicates); err != nil {
+			return nil, err
+		}
+
+		events.Record(models.NewEvent(
+			models.EventHostsMerged,
+			&host,
+			fmt.Sprintf("merged %d duplicate records of %s into %s", len(duplicates), host.Hostname, host.ID),
+		).WithDetail("duplicates", strings.Join(duplicates, ",")))
+		report.Merged = append(report.Merged, models.MergedHost{
+			ID:         host.ID,
+			Hostname:   host.Hostname,
+			Duplicates: duplicates,
+		})
+	}
+
+	report.IndexesRemoved, report.IndexesMoved, err = s.CleanIndexes()
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
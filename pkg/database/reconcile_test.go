@@ -0,0 +1,154 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+func TestReconcile(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		// The container was replaced, the new record has a new instance id on the same address
+		first := newTestHost("node-1", "203.0.113.1")
+		first.InstanceID = "old"
+		first.FirstSeenAt = time.Now().UTC().Add(-time.Hour)
+		replaced := newTestHost("node-1", "203.0.113.1")
+		replaced.InstanceID = "new"
+		replaced.Addresses = map[models.Network]string{"vpn": "10.8.0.2"}
+
+		// Another node with the same hostname on other addresses and its own instance
+		other := newTestHost("node-1", "203.0.113.9")
+		other.InstanceID = "other"
+		other.Addresses = nil
+
+		for _, h := range []*models.Host{first, replaced, other} {
+			if err := s.SaveHost(h); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		check := &models.Check{CheckType: models.CheckTCP, Network: models.NetworkPublic, Status: models.StatusSuccess}
+		if err := s.AddCheck(replaced, check); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, func() bool {
+			page, err := s.QueryChecks(models.CheckQuery{HostID: replaced.ID})
+			return err == nil && len(page.Checks) == 1
+		})
+
+		var streamed []*models.Event
+		events := NewEventLog(s, time.Hour)
+		events.OnRecord(func(e *models.Event) { streamed = append(streamed, e) })
+
+		report, err := Reconcile(s, events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Merged) != 1 || report.Merged[0].ID != first.ID ||
+			len(report.Merged[0].Duplicates) != 1 || report.Merged[0].Duplicates[0] != replaced.ID {
+			t.Fatalf("expected the replaced record merged into the first, got %+v", report.Merged)
+		}
+
+		merged, err := s.GetHostByID(first.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if merged.InstanceID != "new" || merged.Addresses["vpn"] != "10.8.0.2" {
+			t.Errorf("expected the instance and addresses of the latest record, got %+v", merged)
+		}
+		if _, err := s.GetHostByID(replaced.ID); err != ErrNotFound {
+			t.Errorf("expected the duplicate to be removed, got %v", err)
+		}
+		if _, err := s.GetHostByID(other.ID); err != nil {
+			t.Errorf("expected the other node to be kept, got %v", err)
+		}
+		if h, err := s.GetHostByIP("10.8.0.2"); err != nil || h.ID != first.ID {
+			t.Errorf("expected the address of the duplicate to find the merged host, got %v %v", h, err)
+		}
+
+		page, err := s.QueryChecks(models.CheckQuery{HostID: first.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Checks) != 1 || page.Checks[0].HostID != first.ID {
+			t.Errorf("expected the check of the duplicate to move to the merged host, got %+v", page.Checks)
+		}
+
+		if len(streamed) != 1 || streamed[0].Type != models.EventHostsMerged {
+			t.Errorf("expected the merge to be sent to the listeners, got %+v", streamed)
+		}
+		saved, err := s.GetEvents(models.EventFilter{Types: []models.EventType{models.EventHostsMerged}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(saved.Events) != 1 || saved.Events[0].HostID != first.ID {
+			t.Errorf("expected the merge to be saved, got %+v", saved.Events)
+		}
+
+		// Nothing is left to merge
+		report, err = Reconcile(s, events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Merged) != 0 {
+			t.Errorf("expected nothing to merge the second time, got %+v", report.Merged)
+		}
+	})
+}
+
+func TestMergeHosts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		into := newTestHost("node-1", "203.0.113.1")
+		from := newTestHost("node-1-old", "203.0.113.2")
+		from.Addresses = nil
+		for _, h := range []*models.Host{into, from} {
+			if err := s.SaveHost(h); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, h := range []*models.Host{into, from} {
+			check := &models.Check{CheckType: models.CheckHTTP, Network: models.NetworkPublic, Status: models.StatusSuccess}
+			if err := s.AddCheck(h, check); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if err := s.RecordInbound(from, models.CheckTCP, 10); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, func() bool {
+			page, err := s.QueryChecks(models.CheckQuery{})
+			return err == nil && len(page.Checks) == 2
+		})
+
+		if err := s.MergeHosts(into, []string{from.ID}); err != nil {
+			t.Fatal(err)
+		}
+
+		hosts, err := s.GetHosts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hosts) != 1 || hosts[0].ID != into.ID {
+			t.Fatalf("expected only the host merged into, got %+v", hosts)
+		}
+
+		got, err := s.GetHostByID(into.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uptime := got.CheckUptime.Windows["1h"]
+		if uptime.TotalChecks != 2 {
+			t.Errorf("expected the uptime of both hosts, got %+v", uptime)
+		}
+		latest := got.LatestChecks.Network(models.NetworkPublic).HTTP
+		if len(latest) != 1 || latest[0].HostID != into.ID {
+			t.Errorf("expected one latest check of the merged host, got %+v", latest)
+		}
+		if h, err := s.GetHostByIP("203.0.113.2"); err != nil || h.ID != into.ID {
+			t.Errorf("expected the address of the duplicate to find the merged host, got %v %v", h, err)
+		}
+	})
+}
@@ -0,0 +1,315 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// forEachStore runs the test against every backend
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) {
+		s := NewMemory()
+		defer s.Close()
+		test(t, s)
+	})
+
+	t.Run("badger", func(t *testing.T) {
+		s, done := newTestBadger(t)
+		defer done()
+		test(t, s)
+	})
+}
+
+// newTestBadger opens a badger database in a temporary directory that is removed when done
+func newTestBadger(t testing.TB) (*Badger, func()) {
+	dir, err := ioutil.TempDir("", "service_tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewBadger(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// eventually retries the condition as stores may write checks shortly after they are added
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met after 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newTestHost(hostname, ip string) *models.Host {
+	return &models.Host{
+		Hostname:  hostname,
+		PublicIP:  ip,
+		Addresses: map[models.Network]string{"vpn": "10.8.0.1"},
+		Labels:    map[string]string{"region": "us-east"},
+	}
+}
+
+func TestStoreHosts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		host := newTestHost("node-1", "203.0.113.1")
+		if err := s.SaveHost(host); err != nil {
+			t.Fatal(err)
+		}
+		if host.ID == "" {
+			t.Fatal("expected the host to be assigned an id")
+		}
+
+		// The store keeps its own copy of the host
+		host.Labels["region"] = "changed"
+		host.Addresses["vpn"] = "changed"
+
+		for name, get := range map[string]func() (*models.Host, error){
+			"id":       func() (*models.Host, error) { return s.GetHostByID(host.ID) },
+			"hostname": func() (*models.Host, error) { return s.GetHostByHostname("node-1") },
+			"ip":       func() (*models.Host, error) { return s.GetHostByIP("203.0.113.1") },
+			"address":  func() (*models.Host, error) { return s.GetHostByIP("10.8.0.1") },
+		} {
+			got, err := get()
+			if err != nil {
+				t.Fatalf("by %s: %v", name, err)
+			}
+			if got.ID != host.ID {
+				t.Errorf("by %s: got host %s, expected %s", name, got.ID, host.ID)
+			}
+			if got.Labels["region"] != "us-east" || got.Addresses["vpn"] != "10.8.0.1" {
+				t.Errorf("by %s: stored host changed with the saved one: %v %v", name, got.Labels, got.Addresses)
+			}
+
+			// Nor does changing a loaded host change the store
+			got.Labels["region"] = "changed"
+		}
+
+		hosts, err := s.GetHosts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hosts) != 1 || hosts[0].Labels["region"] != "us-east" {
+			t.Fatalf("expected the one unchanged host, got %+v", hosts)
+		}
+
+		// Moving to another address removes the old one from the index
+		moved, err := s.GetHostByID(host.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		moved.PublicIP = "203.0.113.2"
+		if err := s.SaveHost(moved); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetHostByIP("203.0.113.1"); err != ErrNotFound {
+			t.Errorf("expected the old address to be removed, got %v", err)
+		}
+		if got, err := s.GetHostByIP("203.0.113.2"); err != nil || got.ID != host.ID {
+			t.Errorf("expected the new address to find the host, got %v %v", got, err)
+		}
+
+		if _, err := s.GetHostByID("missing"); err != ErrNotFound {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestStoreChecks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		host := newTestHost("node-1", "203.0.113.1")
+		if err := s.SaveHost(host); err != nil {
+			t.Fatal(err)
+		}
+
+		statuses := []models.Status{models.StatusSuccess, models.StatusError, models.StatusSuccess}
+		for _, status := range statuses {
+			check := &models.Check{
+				CheckType:    models.CheckHTTP,
+				Network:      models.NetworkPublic,
+				Status:       status,
+				StatusCode:   200,
+				ResponseBody: "ok",
+			}
+			if err := s.AddCheck(host, check); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		var page *models.CheckPage
+		eventually(t, func() bool {
+			var err error
+			page, err = s.QueryChecks(models.CheckQuery{HostID: host.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return len(page.Checks) == len(statuses)
+		})
+
+		for i := 1; i < len(page.Checks); i++ {
+			if page.Checks[i].CheckedAt.Before(page.Checks[i-1].CheckedAt) {
+				t.Fatal("expected the checks oldest first")
+			}
+		}
+		for _, check := range page.Checks {
+			if check.ResponseBody != "ok" {
+				t.Errorf("expected the response body to be kept, got %q", check.ResponseBody)
+			}
+		}
+
+		// The range includes its start and excludes its end
+		between, err := s.GetChecksBetween(page.Checks[1].CheckedAt, page.Checks[2].CheckedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(between) != 1 || between[0].ID != page.Checks[1].ID {
+			t.Errorf("expected the middle check between its time and the next, got %+v", between)
+		}
+
+		errors, err := s.QueryChecks(models.CheckQuery{HostID: host.ID, Status: models.StatusError})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(errors.Checks) != 1 {
+			t.Errorf("expected 1 failed check, got %d", len(errors.Checks))
+		}
+
+		got, err := s.GetHostByID(host.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		latest := got.LatestChecks.Network(models.NetworkPublic).HTTP
+		if len(latest) != 1 || latest[0].ID != page.Checks[len(page.Checks)-1].ID {
+			t.Errorf("expected the newest check as the latest, got %+v", latest)
+		}
+
+		uptime := got.CheckUptime.Windows["1h"]
+		if uptime.TotalChecks != 3 || uptime.TotalSuccess != 2 {
+			t.Errorf("expected 2 of 3 checks up in the last hour, got %+v", uptime)
+		}
+	})
+}
+
+func TestStoreEvents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		host := newTestHost("node-1", "203.0.113.1")
+		if err := s.SaveHost(host); err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now().UTC()
+		for i, eventType := range []models.EventType{models.EventHostDiscovered, models.EventServiceRestarted, models.EventHostRebooted} {
+			e := models.NewEvent(eventType, host, string(eventType))
+			e.At = start.Add(time.Duration(i) * time.Second)
+			if err := s.SaveEvent(e, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		events, err := s.GetEvents(models.EventFilter{HostID: host.ID, Start: start.Add(-time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events.Events) != 3 || events.Next != "" {
+			t.Fatalf("expected 3 events on one page, got %d", len(events.Events))
+		}
+
+		first, err := s.GetEvents(models.EventFilter{Start: start.Add(-time.Minute), Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(first.Events) != 2 || first.Next == "" {
+			t.Fatalf("expected a page of 2 events with a next page, got %d", len(first.Events))
+		}
+		after, err := models.ParseCursor(first.Next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last, err := s.GetEvents(models.EventFilter{Start: start.Add(-time.Minute), Limit: 2, After: after})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(last.Events) != 1 || last.Next != "" || last.Events[0].Type != models.EventHostRebooted {
+			t.Errorf("expected the newest event on the last page, got %+v", last)
+		}
+
+		restarts, err := s.GetEvents(models.EventFilter{
+			Types: []models.EventType{models.EventServiceRestarted},
+			Start: start.Add(-time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(restarts.Events) != 1 || restarts.Events[0].Type != models.EventServiceRestarted {
+			t.Errorf("expected the service restart, got %+v", restarts.Events)
+		}
+	})
+}
+
+func TestStoreIncidents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		host := newTestHost("node-1", "203.0.113.1")
+		start := time.Now().UTC().Add(-time.Hour)
+		for i := 0; i < 5; i++ {
+			incident := models.NewIncident(host, models.NetworkPublic, start.Add(time.Duration(i)*time.Minute))
+			if i < 4 {
+				incident.Close(incident.StartedAt.Add(time.Second))
+			}
+			if err := s.SaveIncident(incident, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var started []time.Time
+		filter := models.IncidentFilter{Limit: 2}
+		for pages := 1; ; pages++ {
+			page, err := s.GetIncidents(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, i := range page.Incidents {
+				started = append(started, i.StartedAt)
+			}
+			if page.Next == "" {
+				if pages != 3 {
+					t.Errorf("expected 3 pages, got %d", pages)
+				}
+				break
+			}
+			if filter.After, err = models.ParseCursor(page.Next); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(started) != 5 {
+			t.Fatalf("expected 5 incidents, got %d", len(started))
+		}
+		for i := 1; i < len(started); i++ {
+			if !started[i].Before(started[i-1]) {
+				t.Fatal("expected the incidents most recently started first")
+			}
+		}
+
+		open, err := s.GetIncidents(models.IncidentFilter{OpenOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(open.Incidents) != 1 || !open.Incidents[0].Open() {
+			t.Errorf("expected the open incident, got %+v", open.Incidents)
+		}
+	})
+}
@@ -0,0 +1,238 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+
+	KindHosts   = "hosts"
+	KindChecks  = "checks"
+	KindRollups = "rollups"
+)
+
+// Options selects what is exported. The time range applies to checks and rollups,
+// rollups are exported at the resolution, by default hour.
+type Options struct {
+	Kind       string
+	Format     string
+	Start      time.Time
+	End        time.Time
+	Resolution models.Resolution
+}
+
+// Validate checks the options and fills in the defaults
+func (o *Options) Validate() error {
+	switch o.Kind {
+	case KindHosts, KindChecks, KindRollups:
+	default:
+		return fmt.Errorf("unknown export %q, must be hosts, checks or rollups", o.Kind)
+	}
+
+	if o.Format == "" {
+		o.Format = FormatNDJSON
+	}
+	if o.Format != FormatNDJSON && o.Format != FormatCSV {
+		return fmt.Errorf("unknown export format %q, must be ndjson or csv", o.Format)
+	}
+
+	if o.Resolution == "" {
+		o.Resolution = models.ResolutionHour
+	}
+	if o.Resolution.Duration() == 0 {
+		return fmt.Errorf("unknown resolution %q, must be minute, hour or day", o.Resolution)
+	}
+	return nil
+}
+
+// ContentType is the mime type of the format
+func (o *Options) ContentType() string {
+	if o.Format == FormatCSV {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+// Write streams the hosts, checks or rollups selected by the options to w, one record per line
+func Write(db database.Store, w io.Writer, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	enc := newEncoder(w, opts)
+	var err error
+	switch opts.Kind {
+	case KindHosts:
+		err = writeHosts(db, enc)
+	case KindChecks:
+		err = writeChecks(db, enc, opts)
+	case KindRollups:
+		err = writeRollups(db, enc, opts)
+	}
+	if err != nil {
+		return err
+	}
+	return enc.flush()
+}
+
+func writeHosts(db database.Store, enc *encoder) error {
+	hosts, err := db.GetHosts()
+	if err != nil {
+		return err
+	}
+
+	if err := enc.header("id", "hostname", "instanceId", "internalIp", "publicIp", "serviceRestarts", "firstSeenAt", "lastSeenAt"); err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		err := enc.write(h,
+			h.ID,
+			h.Hostname,
+			h.InstanceID,
+			h.InternalIP,
+			h.PublicIP,
+			strconv.Itoa(h.ServiceRestarts),
+			formatTime(h.FirstSeenAt),
+			formatTime(h.LastSeenAt),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChecks pages through the checks in the range so they are never all held in memory
+func writeChecks(db database.Store, enc *encoder, opts Options) error {
+	q := models.CheckQuery{
+		Start: opts.Start,
+		End:   opts.End,
+		Limit: models.MaxCheckQueryLimit,
+	}
+
+	if err := enc.header("checkedAt", "hostId", "network", "checkType", "status", "statusCode", "responseTime", "sourceIp", "checkErrorMessage"); err != nil {
+		return err
+	}
+	for {
+		page, err := db.QueryChecks(q)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range page.Checks {
+			err := enc.write(c,
+				formatTime(c.CheckedAt),
+				c.HostID,
+				string(c.Network),
+				string(c.CheckType),
+				string(c.Status),
+				strconv.Itoa(c.StatusCode),
+				strconv.FormatInt(int64(c.ResponseTime), 10),
+				c.SourceIP,
+				c.CheckErrorMessage,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		if page.Next == "" {
+			return nil
+		}
+		q.After, err = models.ParseCheckCursor(page.Next)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeRollups(db database.Store, enc *encoder, opts Options) error {
+	rollups, err := db.GetRollups(models.RollupFilter{
+		Resolution: opts.Resolution,
+		Start:      opts.Start,
+		End:        opts.End,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := enc.header("start", "resolution", "hostId", "network", "checkType", "count", "success", "min", "avg", "max", "p50", "p90", "p99"); err != nil {
+		return err
+	}
+	for _, r := range rollups {
+		// The histogram is only needed to merge rollups, not for analysis
+		r.Latency = nil
+
+		err := enc.write(r,
+			formatTime(r.Start),
+			string(r.Resolution),
+			r.HostID,
+			string(r.Network),
+			string(r.CheckType),
+			strconv.FormatUint(r.Count, 10),
+			strconv.FormatUint(r.Success, 10),
+			strconv.FormatInt(int64(r.Min), 10),
+			strconv.FormatInt(int64(r.Avg), 10),
+			strconv.FormatInt(int64(r.Max), 10),
+			strconv.FormatInt(int64(r.P50), 10),
+			strconv.FormatInt(int64(r.P90), 10),
+			strconv.FormatInt(int64(r.P99), 10),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// encoder writes records as json lines or csv rows. Durations in csv are in nanoseconds like in json.
+type encoder struct {
+	json *json.Encoder
+	csv  *csv.Writer
+}
+
+func newEncoder(w io.Writer, opts Options) *encoder {
+	if opts.Format == FormatCSV {
+		return &encoder{csv: csv.NewWriter(w)}
+	}
+	return &encoder{json: json.NewEncoder(w)}
+}
+
+func (e *encoder) header(columns ...string) error {
+	if e.csv == nil {
+		return nil
+	}
+	return e.csv.Write(columns)
+}
+
+func (e *encoder) write(v interface{}, row ...string) error {
+	if e.csv == nil {
+		return e.json.Encode(v)
+	}
+	return e.csv.Write(row)
+}
+
+func (e *encoder) flush() error {
+	if e.csv == nil {
+		return nil
+	}
+	e.csv.Flush()
+	return e.csv.Error()
+}
@@ -0,0 +1,243 @@
+package incident
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/config"
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// series identifies the checks of one type on one network of a host
+type series struct {
+	hostID    string
+	network   models.Network
+	checkType models.CheckType
+}
+
+// outage is where an incident is tracked, each host and network
+type outage struct {
+	hostID  string
+	network models.Network
+}
+
+// open is an incident that is still open and the check types still failing in it
+type open struct {
+	incident *models.Incident
+	failing  map[models.CheckType]bool
+}
+
+// Tracker turns consecutive failed checks into incidents. An incident is opened per host
+// and network once a check type fails the threshold number of times in a row, and
+// closed once every check type that failed in it succeeds again, or once the host
+// disappears from discovery or the host or network is no longer checked.
+type Tracker struct {
+	db        database.Store
+	threshold int
+	retention time.Duration
+	events    *database.EventLog
+
+	mu sync.Mutex
+	// streaks are the failed checks in a row of each series that has not opened an incident yet
+	streaks map[series][]models.Check
+	open    map[outage]*open
+	// gone are the ids of the hosts that disappeared, whose failures don't open incidents
+	gone map[string]bool
+}
+
+// NewTracker continues the incidents that were still open when the node stopped. Incidents
+// opening and resolving are recorded in the event log.
+func NewTracker(db database.Store, conf *config.Config, events *database.EventLog) (*Tracker, error) {
+	t := &Tracker{
+		db:        db,
+		threshold: conf.Incidents.Threshold,
+		retention: conf.Incidents.Retention,
+		events:    events,
+		streaks:   make(map[series][]models.Check),
+		open:      make(map[outage]*open),
+		gone:      make(map[string]bool),
+	}
+	if t.threshold < 1 {
+		t.threshold = 1
+	}
+
+	filter := models.IncidentFilter{OpenOnly: true, Limit: models.MaxCheckQueryLimit}
+	for {
+		page, err := db.GetIncidents(filter)
+		if err != nil {
+			return nil, err
+		}
+		for i := range page.Incidents {
+			o := &open{incident: &page.Incidents[i], failing: make(map[models.CheckType]bool)}
+			for _, checkType := range o.incident.CheckTypes {
+				o.failing[checkType] = true
+			}
+			t.open[outage{hostID: o.incident.HostID, network: o.incident.Network}] = o
+		}
+
+		if page.Next == "" {
+			return t, nil
+		}
+		if filter.After, err = models.ParseCursor(page.Next); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Observe updates the incidents of the host with the result of a check
+func (t *Tracker) Observe(h *models.Host, check *models.Check) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.gone[h.ID] {
+		return
+	}
+
+	s := series{hostID: h.ID, network: check.Network, checkType: check.CheckType}
+	key := outage{hostID: h.ID, network: check.Network}
+	o := t.open[key]
+
+	if !check.Failed() {
+		delete(t.streaks, s)
+		if o == nil || !o.failing[check.CheckType] {
+			return
+		}
+
+		delete(o.failing, check.CheckType)
+		if len(o.failing) == 0 {
+			t.close(key, o, h, check.CheckedAt, "")
+			return
+		}
+		t.save(o.incident)
+		return
+	}
+
+	// A type already failing in an open incident adds to it straight away
+	if o != nil && o.failing[check.CheckType] {
+		o.incident.AddFailure(check)
+		t.save(o.incident)
+		return
+	}
+
+	failures := append(t.streaks[s], *check)
+	if len(failures) < t.threshold {
+		t.streaks[s] = failures
+		return
+	}
+	delete(t.streaks, s)
+
+	if o == nil {
+		o = &open{
+			incident: models.NewIncident(h, check.Network, failures[0].CheckedAt),
+			failing:  make(map[models.CheckType]bool),
+		}
+		t.open[key] = o
+		t.events.Record(models.NewEvent(
+			models.EventIncidentOpened,
+			h,
+			fmt.Sprintf("incident on %s %s opened: %s", h.Hostname, check.Network, check.CheckErrorMessage),
+		).WithDetail("incident", o.incident.ID))
+	}
+
+	o.failing[check.CheckType] = true
+	for i := range failures {
+		o.incident.AddFailure(&failures[i])
+	}
+	t.save(o.incident)
+}
+
+// CloseHost closes the open incidents of a host that disappeared from discovery. Its failures
+// don't open incidents again until Resume is called for it.
+func (t *Tracker) CloseHost(h *models.Host, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.gone[h.ID] = true
+	t.closeHost(h, reason)
+}
+
+// Resume opens incidents for the failures of a host again once it is found again
+func (t *Tracker) Resume(hostID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.gone, hostID)
+}
+
+// CloseUnchecked closes the open incidents of the hosts and networks left out of a round of
+// checks, because the host was merged or removed, has no address left or isn't matched by the
+// peer selector, or no longer has the network. known are the ids of every stored host and
+// checked the networks of each host in the round, both read before the lock is taken.
+func (t *Tracker) CloseUnchecked(known map[string]bool, checked map[string]map[models.Network]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now().UTC()
+	for key, o := range t.open {
+		if checked[key.hostID][key.network] {
+			continue
+		}
+
+		reason := "the network is no longer checked"
+		switch {
+		case !known[key.hostID]:
+			reason = "the host was merged or removed"
+		case checked[key.hostID] == nil:
+			reason = "the host is no longer checked"
+		}
+		t.close(key, o, &models.Host{ID: key.hostID, Hostname: o.incident.Hostname}, now, reason)
+	}
+
+	for s := range t.streaks {
+		if !checked[s.hostID][s.network] {
+			delete(t.streaks, s)
+		}
+	}
+	for id := range t.gone {
+		if !known[id] {
+			delete(t.gone, id)
+		}
+	}
+}
+
+// closeHost closes every open incident of the host and forgets its streaks of failures
+func (t *Tracker) closeHost(h *models.Host, reason string) {
+	now := time.Now().UTC()
+	for key, o := range t.open {
+		if key.hostID == h.ID {
+			t.close(key, o, h, now, reason)
+		}
+	}
+	for s := range t.streaks {
+		if s.hostID == h.ID {
+			delete(t.streaks, s)
+		}
+	}
+}
+
+// close ends the incident, records it being resolved with the reason if it didn't end
+// with its checks succeeding again and saves it
+func (t *Tracker) close(key outage, o *open, h *models.Host, at time.Time, reason string) {
+	o.incident.Close(at)
+	delete(t.open, key)
+
+	message := fmt.Sprintf("incident on %s %s resolved after %s", h.Hostname, key.network, o.incident.Duration)
+	if reason != "" {
+		message = fmt.Sprintf("incident on %s %s closed after %s: %s", h.Hostname, key.network, o.incident.Duration, reason)
+	}
+	e := models.NewEvent(models.EventIncidentResolved, h, message).WithDetail("incident", o.incident.ID)
+	if reason != "" {
+		e = e.WithDetail("reason", reason)
+	}
+	t.events.Record(e)
+	t.save(o.incident)
+}
+
+func (t *Tracker) save(i *models.Incident) {
+	if err := t.db.SaveIncident(i, t.retention); err != nil {
+		log.Printf("error saving incident (%s): %v", i.ID, err)
+	}
+}
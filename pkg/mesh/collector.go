@@ -0,0 +1,239 @@
+package mesh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/client"
+	"github.com/brentahughes/service_tester/pkg/config"
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+const peerTimeout = 5 * time.Second
+
+// cached is a matrix and when it was collected
+type cached struct {
+	matrix *models.MeshMatrix
+	at     time.Time
+}
+
+// fetchFunc returns the cells a peer reports from the api at ip
+type fetchFunc func(peer models.Host, ip string) ([]models.MeshCell, error)
+
+// Collector builds the full mesh and the inbound view of this node from its own results and
+// the results every peer reports through its api. Both are cached as every request fans out
+// to every peer.
+type Collector struct {
+	db       database.Store
+	client   *http.Client
+	ttl      time.Duration
+	parallel int
+
+	// mu is held while collecting so concurrent requests wait for one fan out
+	mu      sync.Mutex
+	mesh    cached
+	inbound cached
+}
+
+func NewCollector(db database.Store, conf *config.Config) *Collector {
+	parallel := conf.ParallelChecks
+	if parallel < 1 {
+		parallel = 1
+	}
+	return &Collector{
+		db:       db,
+		client:   &http.Client{Timeout: peerTimeout},
+		ttl:      conf.MeshCacheTTL,
+		parallel: parallel,
+	}
+}
+
+// Matrix returns the cached full mesh, collecting it again when it expired or refresh is set
+func (m *Collector) Matrix(refresh bool) (*models.MeshMatrix, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cachedMatrix(&m.mesh, refresh, m.collectMesh)
+}
+
+// Inbound returns the cached results every peer has against this node, collecting them
+// again when they expired or refresh is set
+func (m *Collector) Inbound(refresh bool) (*models.MeshMatrix, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cachedMatrix(&m.inbound, refresh, m.collectInbound)
+}
+
+func (m *Collector) cachedMatrix(c *cached, refresh bool, collect func() (*models.MeshMatrix, error)) (*models.MeshMatrix, error) {
+	if !refresh && c.matrix != nil && time.Since(c.at) < m.ttl {
+		return c.matrix, nil
+	}
+
+	matrix, err := collect()
+	if err != nil {
+		return nil, err
+	}
+	c.matrix, c.at = matrix, time.Now()
+	return matrix, nil
+}
+
+// Results returns the results of this node against the host with the hostname
+func Results(db database.Store, hostname string) (*models.MeshResults, error) {
+	current, err := db.GetCurrentHost()
+	if err != nil {
+		return nil, err
+	}
+
+	results := &models.MeshResults{
+		Source:      current.Hostname,
+		Destination: hostname,
+		Cells:       []models.MeshCell{},
+	}
+
+	host, err := db.GetHostByHostname(hostname)
+	if err != nil {
+		if err == database.ErrNotFound {
+			return results, nil
+		}
+		return nil, err
+	}
+
+	// Looked up again by id to load the latest checks and uptime
+	host, err = db.GetHostByID(host.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.SetLatency(db, host); err != nil {
+		return nil, err
+	}
+
+	results.Known = true
+	results.Cells = models.MeshCells(current.Hostname, []models.Host{*host})
+	return results, nil
+}
+
+func (m *Collector) collectMesh() (*models.MeshMatrix, error) {
+	current, err := m.db.GetCurrentHost()
+	if err != nil {
+		return nil, err
+	}
+
+	hosts, err := m.db.GetHostsWithStatuses()
+	if err != nil {
+		return nil, err
+	}
+	for i := range hosts {
+		if err := database.SetLatency(m.db, &hosts[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	matrix := &models.MeshMatrix{
+		GeneratedAt: time.Now().UTC(),
+		Sources: []models.MeshSource{{
+			Hostname:  current.Hostname,
+			Reachable: true,
+			FetchedAt: time.Now().UTC(),
+		}},
+		Cells: models.MeshCells(current.Hostname, hosts),
+	}
+
+	m.fanOut(current, hosts, matrix, func(peer models.Host, ip string) ([]models.MeshCell, error) {
+		peerHosts, _, err := client.New(ip, m.client).Hosts(context.Background(), "")
+		if err != nil {
+			return nil, err
+		}
+		return models.MeshCells(peer.Hostname, peerHosts), nil
+	})
+
+	matrix.Sort()
+	return matrix, nil
+}
+
+// collectInbound asks every peer for its results against this node
+func (m *Collector) collectInbound() (*models.MeshMatrix, error) {
+	current, err := m.db.GetCurrentHost()
+	if err != nil {
+		return nil, err
+	}
+
+	hosts, err := m.db.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	matrix := &models.MeshMatrix{
+		GeneratedAt: time.Now().UTC(),
+		Sources:     []models.MeshSource{},
+		Cells:       []models.MeshCell{},
+	}
+
+	m.fanOut(current, hosts, matrix, func(peer models.Host, ip string) ([]models.MeshCell, error) {
+		results, _, err := client.New(ip, m.client).Results(context.Background(), current.Hostname)
+		if err != nil {
+			return nil, err
+		}
+		return results.Cells, nil
+	})
+
+	matrix.Sort()
+	return matrix, nil
+}
+
+// fanOut adds the cells of every peer to the matrix, with the peers that couldn't be reached
+// added to the sources with the error
+func (m *Collector) fanOut(current *models.Host, hosts []models.Host, matrix *models.MeshMatrix, fetch fetchFunc) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, m.parallel)
+	for i := range hosts {
+		// A record of this node, such as when it discovered itself, has the same results
+		if hosts[i].Hostname == current.Hostname {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(peer models.Host) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			source := models.MeshSource{Hostname: peer.Hostname, HostID: peer.ID}
+			cells, err := m.fetchPeer(peer, fetch)
+			source.FetchedAt = time.Now().UTC()
+			if err != nil {
+				source.Error = err.Error()
+			} else {
+				source.Reachable = true
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			matrix.Sources = append(matrix.Sources, source)
+			matrix.Cells = append(matrix.Cells, cells...)
+		}(hosts[i])
+	}
+	wg.Wait()
+}
+
+// fetchPeer tries each of the peer's addresses until one answers
+func (m *Collector) fetchPeer(peer models.Host, fetch fetchFunc) ([]models.MeshCell, error) {
+	addrs := peer.NetworkAddresses()
+	var lastErr error
+	for _, network := range peer.Networks() {
+		cells, err := fetch(peer, addrs[network])
+		if err == nil {
+			return cells, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("%s has no addresses", peer.Hostname)
+	}
+	return nil, lastErr
+}
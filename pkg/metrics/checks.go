@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/config"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+const (
+	// otherPeer is the peer label of the peers above the max number of peers
+	otherPeer = "other"
+	// staleAfter is how long the series of a peer that is no longer checked is kept
+	staleAfter = time.Hour
+	// expireEvery is how often checks drop the stale series when the metrics aren't gathered
+	expireEvery = time.Minute
+)
+
+// checkSeries is the metrics of the checks of one type on one network of a peer
+type checkSeries struct {
+	labels   []Label
+	peer     string
+	checks   uint64
+	failures uint64
+	up       float64
+	latency  float64
+	hist     *HistogramValue
+	lastSeen time.Time
+}
+
+// ObserveCheck records a check of the host in the check metrics
+func (r *Registry) ObserveCheck(h *models.Host, check *models.Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Peers that are no longer checked stop counting towards the max number of peers even
+	// when nothing gathers the metrics
+	now := time.Now()
+	if now.Sub(r.expiredAt) >= expireEvery {
+		r.expire(now)
+	}
+
+	labels, peer := r.checkLabels(h, check)
+	key := labelKey(labels)
+	s, ok := r.series[key]
+	if !ok {
+		s = &checkSeries{labels: labels, peer: peer}
+		if len(r.conf.Buckets) > 0 {
+			s.hist = &HistogramValue{Bounds: r.conf.Buckets, Counts: make([]uint64, len(r.conf.Buckets)+1)}
+		}
+		r.series[key] = s
+		r.peers[peer] = true
+	}
+
+	s.lastSeen = now
+	s.checks++
+	if check.Failed() {
+		s.failures++
+		s.up = 0
+		return
+	}
+	// Checks that couldn't run, such as ping without the permission for it, say nothing about the peer
+	if check.Status == models.StatusUnknown {
+		return
+	}
+
+	// Failed checks report the timeout as their response time so only successes count as latency
+	s.up = 1
+	s.latency = check.ResponseTime.Seconds()
+	if s.hist != nil {
+		s.hist.observe(s.latency)
+	}
+}
+
+// checkLabels returns the labels of the series of the check and the peer it is counted as.
+// Peers above the max number of peers are counted as other.
+func (r *Registry) checkLabels(h *models.Host, check *models.Check) ([]Label, string) {
+	var labels []Label
+	var peer string
+	switch r.conf.PeerLabel {
+	case "id":
+		peer = h.ID
+	case "hostname":
+		peer = h.Hostname
+	}
+
+	if peer != "" {
+		if !r.peers[peer] && len(r.peers) >= r.conf.MaxPeers {
+			peer = otherPeer
+		}
+		labels = append(labels, Label{Name: "peer", Value: peer})
+	}
+
+	labels = append(labels,
+		Label{Name: "network", Value: string(check.Network)},
+		Label{Name: "type", Value: strings.ToLower(string(check.CheckType))},
+	)
+	for _, key := range r.conf.HostLabels {
+		labels = append(labels, Label{Name: config.MetricLabelName(key), Value: h.Labels[key]})
+	}
+	return labels, peer
+}
+
+func labelKey(labels []Label) string {
+	values := make([]string, len(labels))
+	for i, l := range labels {
+		values[i] = l.Value
+	}
+	return strings.Join(values, "\xff")
+}
+
+// expire drops the series of peers that are no longer checked and counts the peers left
+func (r *Registry) expire(now time.Time) {
+	r.peers = make(map[string]bool)
+	for key, s := range r.series {
+		if now.Sub(s.lastSeen) > staleAfter {
+			delete(r.series, key)
+			continue
+		}
+		r.peers[s.peer] = true
+	}
+	r.expiredAt = now
+}
+
+// gatherChecks returns the check families after dropping the series of peers that are no
+// longer checked
+func (r *Registry) gatherChecks(now time.Time) []Family {
+	up := Family{Name: namespace + "check_up", Help: "Whether the latest check succeeded", Type: Gauge}
+	latency := Family{Name: namespace + "check_latency_seconds", Help: "Response time of the latest successful check", Type: Gauge}
+	checks := Family{Name: namespace + "checks_total", Help: "Checks run against the peer", Type: Counter}
+	failures := Family{Name: namespace + "check_failures_total", Help: "Checks against the peer that failed", Type: Counter}
+	hist := Family{Name: namespace + "check_duration_seconds", Help: "Response times of successful checks", Type: Histogram}
+
+	r.expire(now)
+	for _, s := range r.series {
+		up.Metrics = append(up.Metrics, Metric{Labels: s.labels, Value: s.up})
+		latency.Metrics = append(latency.Metrics, Metric{Labels: s.labels, Value: s.latency})
+		checks.Metrics = append(checks.Metrics, Metric{Labels: s.labels, Value: float64(s.checks)})
+		failures.Metrics = append(failures.Metrics, Metric{Labels: s.labels, Value: float64(s.failures)})
+		if s.hist != nil {
+			h := *s.hist
+			h.Counts = append([]uint64(nil), s.hist.Counts...)
+			hist.Metrics = append(hist.Metrics, Metric{Labels: s.labels, Histogram: &h})
+		}
+	}
+
+	families := []Family{up, latency, checks, failures}
+	if len(r.conf.Buckets) > 0 {
+		families = append(families, hist)
+	}
+	for _, f := range families {
+		sortMetrics(f.Metrics)
+	}
+	return families
+}
+
+func sortMetrics(metrics []Metric) {
+	sort.Slice(metrics, func(a, b int) bool {
+		return labelKey(metrics[a].Labels) < labelKey(metrics[b].Labels)
+	})
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/config"
+)
+
+// namespace prefixes the name of every metric
+const namespace = "service_tester_"
+
+type MetricType string
+
+const (
+	Gauge     MetricType = "gauge"
+	Counter   MetricType = "counter"
+	Histogram MetricType = "histogram"
+)
+
+// Family is every series of a metric
+type Family struct {
+	Name    string
+	Help    string
+	Type    MetricType
+	Metrics []Metric
+}
+
+// Metric is one series of a family, with a value or a histogram depending on its type
+type Metric struct {
+	Labels    []Label
+	Value     float64
+	Histogram *HistogramValue
+}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// HistogramValue counts observations in buckets with an upper bound. Counts are per bucket,
+// not cumulative, and have one more entry than Bounds for the observations above the last bound.
+type HistogramValue struct {
+	Bounds []float64
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+// observe adds the value to the bucket it falls in
+func (h *HistogramValue) observe(v float64) {
+	i := sort.SearchFloat64s(h.Bounds, v)
+	h.Counts[i]++
+	h.Count++
+	h.Sum += v
+}
+
+// collector returns the series of a family when the metrics are gathered
+type collector struct {
+	name    string
+	help    string
+	t       MetricType
+	collect func() []Metric
+}
+
+// Registry is the metrics of this node. Check metrics are recorded as checks are saved and
+// internal metrics are read from the functions registered for them when gathered.
+type Registry struct {
+	conf config.MetricsConfig
+
+	mu         sync.Mutex
+	series     map[string]*checkSeries
+	peers      map[string]bool
+	expiredAt  time.Time
+	collectors []collector
+}
+
+func NewRegistry(conf *config.Config) *Registry {
+	return &Registry{
+		conf:   conf.Metrics,
+		series: make(map[string]*checkSeries),
+		peers:  make(map[string]bool),
+	}
+}
+
+// Register adds a family of metrics read from collect each time they are gathered
+func (r *Registry) Register(name, help string, t MetricType, collect func() []Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collector{name: namespace + name, help: help, t: t, collect: collect})
+}
+
+// GaugeFunc registers a gauge without labels
+func (r *Registry) GaugeFunc(name, help string, value func() float64) {
+	r.Register(name, help, Gauge, func() []Metric {
+		return []Metric{{Value: value()}}
+	})
+}
+
+// CounterFunc registers a counter without labels
+func (r *Registry) CounterFunc(name, help string, value func() float64) {
+	r.Register(name, help, Counter, func() []Metric {
+		return []Metric{{Value: value()}}
+	})
+}
+
+// Gather returns every family sorted by name
+func (r *Registry) Gather() []Family {
+	r.mu.Lock()
+	families := r.gatherChecks(time.Now())
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	// Registered functions can take locks of their own so they are called without holding the registry's
+	for _, c := range collectors {
+		families = append(families, Family{Name: c.name, Help: c.help, Type: c.t, Metrics: c.collect()})
+	}
+
+	sort.Slice(families, func(a, b int) bool {
+		return families[a].Name < families[b].Name
+	})
+	return families
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// WriteText writes the families in the Prometheus text exposition format
+func WriteText(w io.Writer, families []Family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		if len(f.Metrics) == 0 {
+			continue
+		}
+
+		bw.WriteString("# HELP " + f.Name + " " + helpEscaper.Replace(f.Help) + "\n")
+		bw.WriteString("# TYPE " + f.Name + " " + string(f.Type) + "\n")
+		for _, m := range f.Metrics {
+			if f.Type == Histogram && m.Histogram != nil {
+				writeHistogram(bw, f.Name, m)
+				continue
+			}
+			writeSample(bw, f.Name, m.Labels, m.Value)
+		}
+	}
+	return bw.Flush()
+}
+
+// writeHistogram writes the cumulative buckets, sum and count of a histogram
+func writeHistogram(w *bufio.Writer, name string, m Metric) {
+	h := m.Histogram
+	var cumulative uint64
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		writeSample(w, name+"_bucket", withLabel(m.Labels, "le", formatFloat(bound)), float64(cumulative))
+	}
+	writeSample(w, name+"_bucket", withLabel(m.Labels, "le", "+Inf"), float64(h.Count))
+	writeSample(w, name+"_sum", m.Labels, h.Sum)
+	writeSample(w, name+"_count", m.Labels, float64(h.Count))
+}
+
+func writeSample(w *bufio.Writer, name string, labels []Label, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l.Name + `="` + valueEscaper.Replace(l.Value) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func withLabel(labels []Label, name, value string) []Label {
+	return append(append([]Label(nil), labels...), Label{Name: name, Value: value})
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/config"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+func newTestRegistry(maxPeers int) *Registry {
+	return NewRegistry(&config.Config{Metrics: config.MetricsConfig{
+		PeerLabel:  "hostname",
+		MaxPeers:   maxPeers,
+		HostLabels: []string{"region", "cloud.provider"},
+		Buckets:    []float64{0.25, 1, 4},
+	}})
+}
+
+func observe(r *Registry, h *models.Host, checkType models.CheckType, status models.Status, responseTime time.Duration) {
+	r.ObserveCheck(h, &models.Check{
+		Network:      models.NetworkPublic,
+		CheckType:    checkType,
+		Status:       status,
+		ResponseTime: responseTime,
+	})
+}
+
+func TestWriteText(t *testing.T) {
+	r := newTestRegistry(10)
+	a := &models.Host{ID: "1", Hostname: "a", Labels: map[string]string{"region": "us-east", "cloud.provider": "aws"}}
+	b := &models.Host{ID: "2", Hostname: "b"}
+
+	// A bound is the inclusive upper bound of its bucket and the buckets are written cumulative
+	for _, d := range []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond, 8 * time.Second} {
+		observe(r, a, models.CheckTCP, models.StatusSuccess, d)
+	}
+	observe(r, a, models.CheckTCP, models.StatusError, 10*time.Second)
+	observe(r, b, models.CheckICMP, models.StatusUnknown, 0)
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, r.Gather()); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("testdata/checks.prom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(expected) {
+		t.Errorf("unexpected metrics, got:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestObserveCheckExpiresStaleSeries(t *testing.T) {
+	r := newTestRegistry(1)
+	a := &models.Host{ID: "1", Hostname: "a"}
+	b := &models.Host{ID: "2", Hostname: "b"}
+
+	observe(r, a, models.CheckTCP, models.StatusSuccess, time.Millisecond)
+	observe(r, b, models.CheckTCP, models.StatusSuccess, time.Millisecond)
+	if !r.peers[otherPeer] {
+		t.Fatalf("expected the second peer to be counted as other, got %v", r.peers)
+	}
+
+	// a stops being checked and nothing gathers the metrics in the meantime
+	for _, s := range r.series {
+		s.lastSeen = s.lastSeen.Add(-2 * staleAfter)
+	}
+	r.expiredAt = r.expiredAt.Add(-expireEvery)
+
+	observe(r, b, models.CheckTCP, models.StatusSuccess, time.Millisecond)
+	if len(r.peers) != 1 || !r.peers["b"] {
+		t.Errorf("expected the stale series to be dropped and b to get its own series, got %v", r.peers)
+	}
+	if len(r.series) != 1 {
+		t.Errorf("expected one series left, got %d", len(r.series))
+	}
+}
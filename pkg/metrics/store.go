@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"github.com/brentahughes/service_tester/pkg/database"
+)
+
+// RegisterStore adds the metrics of the database the backend supports
+func (r *Registry) RegisterStore(db database.Store) {
+	if sized, ok := db.(database.Sized); ok {
+		r.Register("db_size_bytes", "Size of the database on disk", Gauge, func() []Metric {
+			lsm, vlog := sized.Size()
+			return []Metric{
+				{Labels: []Label{{Name: "part", Value: "lsm"}}, Value: float64(lsm)},
+				{Labels: []Label{{Name: "part", Value: "vlog"}}, Value: float64(vlog)},
+			}
+		})
+	}
+
+	if pipelined, ok := db.(database.Pipelined); ok {
+		r.GaugeFunc("writer_queue_depth", "Writes waiting for the database writer", func() float64 {
+			return float64(pipelined.WriterStats().QueueDepth)
+		})
+		r.GaugeFunc("writer_queue_capacity", "Writes that can wait for the database writer before workers block", func() float64 {
+			return float64(pipelined.WriterStats().QueueCapacity)
+		})
+		r.CounterFunc("writer_writes_total", "Writes committed by the database writer", func() float64 {
+			return float64(pipelined.WriterStats().Writes)
+		})
+		r.CounterFunc("writer_errors_total", "Batches the database writer failed to commit", func() float64 {
+			return float64(pipelined.WriterStats().Errors)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// MaxCheckQueryLimit is the most checks returned in one page
+const MaxCheckQueryLimit = 1000
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CheckQuery selects a page of checks ordered by the time they were checked. Empty
+// fields match everything.
+type CheckQuery struct {
+	HostID    string
+	Network   Network
+	CheckType CheckType
+	Status    Status
+	Start     time.Time
+	End       time.Time
+	Limit     int
+	After     *CheckCursor
+}
+
+// CheckPage is one page of a check query. Next is empty on the last page.
+type CheckPage struct {
+	Checks []Check `json:"checks"`
+	Next   string  `json:"next,omitempty"`
+}
+
+// CheckCursor is the position of the last check of a page. Checks are ordered by
+// time and then id so checks made at the same time are not skipped.
+type CheckCursor struct {
+	CheckedAt time.Time
+	ID        string
+}
+
+// PageLimit is the limit of the query within the default and max page size
+func (q CheckQuery) PageLimit() int {
+	if q.Limit <= 0 {
+		return checkLimit
+	}
+	if q.Limit > MaxCheckQueryLimit {
+		return MaxCheckQueryLimit
+	}
+	return q.Limit
+}
+
+// From is the earliest time a check can be selected at, used to seek to the first key
+func (q CheckQuery) From() time.Time {
+	if q.After != nil && q.After.CheckedAt.After(q.Start) {
+		return q.After.CheckedAt
+	}
+	return q.Start
+}
+
+// Match reports if the check is selected by the query
+func (q CheckQuery) Match(c Check) bool {
+	if q.HostID != "" && c.HostID != q.HostID {
+		return false
+	}
+	if q.Network != "" && c.Network != q.Network {
+		return false
+	}
+	if q.CheckType != "" && c.CheckType != q.CheckType {
+		return false
+	}
+	if q.Status != "" && c.Status != q.Status {
+		return false
+	}
+	if !q.Start.IsZero() && c.CheckedAt.Before(q.Start) {
+		return false
+	}
+	if !q.End.IsZero() && !c.CheckedAt.Before(q.End) {
+		return false
+	}
+	if q.After != nil && !q.After.Before(c) {
+		return false
+	}
+	return true
+}
+
+// Page sorts the matched checks and cuts them to the limit of the query
+func (q CheckQuery) Page(checks []Check) *CheckPage {
+	SortChecks(checks)
+
+	page := &CheckPage{Checks: checks}
+	if limit := q.PageLimit(); len(checks) > limit {
+		page.Checks = checks[:limit]
+		page.Next = NewCheckCursor(page.Checks[limit-1]).String()
+	}
+	if page.Checks == nil {
+		page.Checks = []Check{}
+	}
+	return page
+}
+
+func NewCheckCursor(c Check) *CheckCursor {
+	return &CheckCursor{CheckedAt: c.CheckedAt, ID: c.ID}
+}
+
+// Before reports if the cursor is ordered before the check
+func (cur *CheckCursor) Before(c Check) bool {
+	return (&Cursor{At: cur.CheckedAt, ID: cur.ID}).Before(c.CheckedAt, c.ID)
+}
+
+// String encodes the cursor to be passed back by clients
+func (cur *CheckCursor) String() string {
+	return (&Cursor{At: cur.CheckedAt, ID: cur.ID}).String()
+}
+
+// ParseCheckCursor decodes a cursor returned in CheckPage.Next
+func ParseCheckCursor(s string) (*CheckCursor, error) {
+	cur, err := ParseCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckCursor{CheckedAt: cur.At, ID: cur.ID}, nil
+}
+
+// SortChecks orders the checks by the time they were checked, then id
+func SortChecks(checks []Check) {
+	sort.Slice(checks, func(a, b int) bool {
+		if !checks[a].CheckedAt.Equal(checks[b].CheckedAt) {
+			return checks[a].CheckedAt.Before(checks[b].CheckedAt)
+		}
+		return checks[a].ID < checks[b].ID
+	})
+}
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"encoding/json"
 	"fmt"
 	"net"
 	"os"
@@ -9,58 +8,52 @@ import (
 	"time"
 
 	"github.com/brentahughes/service_tester/pkg/config"
-	"github.com/dgraph-io/badger"
 	servicehost "github.com/shirou/gopsutil/host"
 )
 
-func GetCurrentHost(db *badger.DB) (*Host, error) {
-	var host Host
-	err := db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(hostsPrefix + currentHostID))
-		if err != nil {
-			return err
-		}
-
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &host)
-		})
-	})
-	if err != nil {
-		return nil, err
+// NewCurrentHost returns the record for this node before it has been stored for the first time
+func NewCurrentHost(conf *config.Config) *Host {
+	return &Host{
+		ID:                CurrentHostID,
+		CurrentHost:       true,
+		ServiceRestarts:   -1,
+		ServiceFirstStart: time.Now().UTC(),
+		CityCode:          conf.DownwardAPI.CityCode,
+		Longitude:         conf.DownwardAPI.Longitude,
+		Latitude:          conf.DownwardAPI.Latitude,
 	}
+}
 
+// SetCurrentUptimes sets the service and host uptime of this node
+func (h *Host) SetCurrentUptimes() error {
 	uptime, err := servicehost.Uptime()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	uptimeDur, err := time.ParseDuration(fmt.Sprintf("%ds", uptime))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	host.ServiceUptime = time.Since(host.ServiceLastStart).Truncate(time.Second)
-	host.HostUptime = uptimeDur
-
-	return &host, nil
-}
+	h.ServiceUptime = time.Since(h.ServiceLastStart).Truncate(time.Second)
+	h.HostUptime = uptimeDur
 
-func UpdateCurrentHost(db *badger.DB, conf *config.Config, init bool) error {
-	host, err := GetCurrentHost(db)
-	if err != nil && err != badger.ErrKeyNotFound {
+	bootTime, err := servicehost.BootTime()
+	if err != nil {
 		return err
 	}
+	h.BootedAt = time.Unix(int64(bootTime), 0).UTC()
+	return nil
+}
 
-	if host == nil {
-		host = &Host{
-			ID:                currentHostID,
-			CurrentHost:       true,
-			ServiceRestarts:   -1,
-			ServiceFirstStart: time.Now().UTC(),
-			CityCode:          conf.DownwardAPI.CityCode,
-			Longitude:         conf.DownwardAPI.Longitude,
-			Latitude:          conf.DownwardAPI.Latitude,
-		}
+// RefreshCurrentHost updates the hostname and addresses of this node. On init the service
+// is also counted as restarted.
+func (h *Host) RefreshCurrentHost(conf *config.Config, init bool) error {
+	// Uniquely identifies this instance so peers can tell it apart from a replacement
+	// that reused the same hostname or ip
+	if h.InstanceID == "" {
+		h.InstanceID = getID()
 	}
 
 	hostname, err := os.Hostname()
@@ -73,25 +66,28 @@ func UpdateCurrentHost(db *badger.DB, conf *config.Config, init bool) error {
 		return err
 	}
 
-	if host.Hostname != hostname {
-		host.Hostname = hostname
+	if h.Hostname != hostname {
+		h.Hostname = hostname
 	}
-	if host.InternalIP != internal {
-		host.InternalIP = internal
+	if h.InternalIP != internal {
+		h.InternalIP = internal
 	}
-	if host.PublicIP != public {
-		host.PublicIP = public
+	if h.PublicIP != public {
+		h.PublicIP = public
 	}
 
-	if init {
-		host.ServiceLastStart = time.Now().UTC()
-		host.ServiceRestarts++
+	addresses, err := getNetworkAddresses(conf)
+	if err != nil {
+		return err
 	}
+	h.Addresses = addresses
+	h.Labels = conf.Labels
 
-	return db.Update(func(txn *badger.Txn) error {
-		hostJSON, _ := json.Marshal(host)
-		return txn.Set([]byte(hostsPrefix+host.ID), hostJSON)
-	})
+	if init {
+		h.ServiceLastStart = time.Now().UTC()
+		h.ServiceRestarts++
+	}
+	return nil
 }
 
 func getLocalHostIPs(conf *config.Config) (string, string, error) {
@@ -153,3 +149,43 @@ func getLocalHostIPs(conf *config.Config) (string, string, error) {
 
 	return internalIP, publicIP, nil
 }
+
+// getNetworkAddresses resolves the additional networks from the config. Each network is
+// either an ip or the name of an interface to take the first ipv4 address from.
+func getNetworkAddresses(conf *config.Config) (map[Network]string, error) {
+	addresses := make(map[Network]string)
+	for name, value := range conf.Networks {
+		network := Network(name)
+		if !network.Valid() {
+			return nil, fmt.Errorf("invalid network name %q", name)
+		}
+
+		if ip := net.ParseIP(value); ip != nil {
+			addresses[network] = ip.String()
+			continue
+		}
+
+		iface, err := net.InterfaceByName(value)
+		if err != nil {
+			return nil, fmt.Errorf("network %s: %v", name, err)
+		}
+
+		ips, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			ipNet, ok := ip.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			addresses[network] = ipNet.IP.String()
+			break
+		}
+
+		if _, ok := addresses[network]; !ok {
+			return nil, fmt.Errorf("network %s: no ipv4 address on interface %s", name, value)
+		}
+	}
+	return addresses, nil
+}
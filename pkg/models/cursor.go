@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor is the position of the last item of a page of events or incidents. Items are
+// ordered by time and then id so items at the same time are not skipped.
+type Cursor struct {
+	At time.Time
+	ID string
+}
+
+// String encodes the cursor to be passed back by clients
+func (cur *Cursor) String() string {
+	raw := fmt.Sprintf("%d.%s", cur.At.UnixNano(), cur.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a cursor returned as the next of a page
+func ParseCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{At: time.Unix(0, nanos).UTC(), ID: parts[1]}, nil
+}
+
+// Before reports if the cursor is ordered before the item at the time with the id
+func (cur *Cursor) Before(at time.Time, id string) bool {
+	if !cur.At.Equal(at) {
+		return cur.At.Before(at)
+	}
+	return cur.ID < id
+}
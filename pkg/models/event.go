@@ -0,0 +1,116 @@
+package models
+
+import (
+	"time"
+)
+
+type EventType string
+
+const (
+	EventHostDiscovered   EventType = "host_discovered"
+	EventHostDisappeared  EventType = "host_disappeared"
+	EventHostReappeared   EventType = "host_reappeared"
+	EventServiceRestarted EventType = "service_restarted"
+	EventHostRebooted     EventType = "host_rebooted"
+	EventAddressChanged   EventType = "address_changed"
+	EventAddressMoved     EventType = "address_moved"
+	EventLabelsChanged    EventType = "labels_changed"
+	EventHostsMerged      EventType = "hosts_merged"
+	EventIncidentOpened   EventType = "incident_opened"
+	EventIncidentResolved EventType = "incident_resolved"
+)
+
+// Event is something that happened to a host of the mesh
+type Event struct {
+	ID       string            `json:"id"`
+	Type     EventType         `json:"type"`
+	HostID   string            `json:"hostId,omitempty"`
+	Hostname string            `json:"hostname,omitempty"`
+	Message  string            `json:"message"`
+	Details  map[string]string `json:"details,omitempty"`
+	At       time.Time         `json:"at"`
+}
+
+// NewEvent returns an event of the host that happened now
+func NewEvent(eventType EventType, h *Host, message string) *Event {
+	e := &Event{
+		ID:      getID(),
+		Type:    eventType,
+		Message: message,
+		At:      time.Now().UTC(),
+	}
+	if h != nil {
+		e.HostID = h.ID
+		e.Hostname = h.Hostname
+	}
+	return e
+}
+
+// WithDetail adds a detail to the event
+func (e *Event) WithDetail(key, value string) *Event {
+	if e.Details == nil {
+		e.Details = make(map[string]string)
+	}
+	e.Details[key] = value
+	return e
+}
+
+// EventFilter selects a page of events in a time range, oldest first. Empty fields match everything.
+type EventFilter struct {
+	Types  []EventType
+	HostID string
+	Start  time.Time
+	End    time.Time
+	Limit  int
+	After  *Cursor
+}
+
+// EventPage is one page of events. Next is empty on the last page.
+type EventPage struct {
+	Events []Event `json:"events"`
+	Next   string  `json:"next,omitempty"`
+}
+
+// Match reports if the event is selected by the filter, the time range is checked by the store
+func (f EventFilter) Match(e Event) bool {
+	if f.HostID != "" && e.HostID != f.HostID {
+		return false
+	}
+	if f.After != nil && !f.After.Before(e.At, e.ID) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// PageLimit is the limit of the filter within the default and max page size
+func (f EventFilter) PageLimit() int {
+	if f.Limit <= 0 {
+		return checkLimit
+	}
+	if f.Limit > MaxCheckQueryLimit {
+		return MaxCheckQueryLimit
+	}
+	return f.Limit
+}
+
+// Page cuts the events, read in order, to the limit of the filter
+func (f EventFilter) Page(events []Event) *EventPage {
+	page := &EventPage{Events: events}
+	if limit := f.PageLimit(); len(events) > limit {
+		page.Events = events[:limit]
+		last := page.Events[limit-1]
+		page.Next = (&Cursor{At: last.At, ID: last.ID}).String()
+	}
+	if page.Events == nil {
+		page.Events = []Event{}
+	}
+	return page
+}
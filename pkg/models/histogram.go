@@ -0,0 +1,108 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// histogramAccuracy is the relative error of quantiles read from a LatencyHistogram
+const histogramAccuracy = 0.01
+
+var histogramGamma = (1 + histogramAccuracy) / (1 - histogramAccuracy)
+
+// LatencyHistogram is a mergeable DDSketch style histogram of response times. Each bucket
+// covers a range of latencies that grows exponentially so any quantile is within 1% of the
+// real value no matter how many checks or windows are merged into it.
+type LatencyHistogram struct {
+	// Buckets maps the bucket index to the number of latencies in it. Latencies are
+	// counted in microseconds, anything under 1µs is in bucket 0.
+	Buckets map[int]uint64 `json:"buckets"`
+	Count   uint64         `json:"count"`
+	Max     time.Duration  `json:"max"`
+}
+
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{
+		Buckets: make(map[int]uint64),
+	}
+}
+
+func histogramIndex(d time.Duration) int {
+	us := float64(d) / float64(time.Microsecond)
+	if us <= 1 {
+		return 0
+	}
+	return int(math.Ceil(math.Log(us) / math.Log(histogramGamma)))
+}
+
+// histogramValue is the latency in the middle of the bucket
+func histogramValue(index int) time.Duration {
+	if index == 0 {
+		return time.Microsecond
+	}
+	us := 2 * math.Pow(histogramGamma, float64(index)) / (1 + histogramGamma)
+	return time.Duration(us * float64(time.Microsecond))
+}
+
+// Add counts a latency
+func (h *LatencyHistogram) Add(d time.Duration) {
+	if h.Buckets == nil {
+		h.Buckets = make(map[int]uint64)
+	}
+
+	h.Buckets[histogramIndex(d)]++
+	h.Count++
+	if d > h.Max {
+		h.Max = d
+	}
+}
+
+// Merge adds the counts of another histogram
+func (h *LatencyHistogram) Merge(other *LatencyHistogram) {
+	if other == nil {
+		return
+	}
+	if h.Buckets == nil {
+		h.Buckets = make(map[int]uint64)
+	}
+
+	for index, count := range other.Buckets {
+		h.Buckets[index] += count
+	}
+	h.Count += other.Count
+	if other.Max > h.Max {
+		h.Max = other.Max
+	}
+}
+
+// Quantile returns the latency at q, between 0 and 1
+func (h *LatencyHistogram) Quantile(q float64) time.Duration {
+	if h == nil || h.Count == 0 {
+		return 0
+	}
+
+	indexes := make([]int, 0, len(h.Buckets))
+	for index := range h.Buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	rank := uint64(math.Ceil(q * float64(h.Count)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for _, index := range indexes {
+		seen += h.Buckets[index]
+		if seen >= rank {
+			value := histogramValue(index)
+			if value > h.Max {
+				return h.Max
+			}
+			return value
+		}
+	}
+	return h.Max
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// exactQuantile is the value at rank ceil(q*n) of the sorted values, as Quantile ranks them
+func exactQuantile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(math.Ceil(q * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func TestLatencyHistogramQuantileError(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name string
+		n    int
+		next func() time.Duration
+	}{
+		{"constant", 100, func() time.Duration { return 25 * time.Millisecond }},
+		{"uniform", 10000, func() time.Duration { return time.Duration(10+r.Intn(500000)) * time.Microsecond }},
+		{"exponential", 10000, func() time.Duration { return time.Duration((r.ExpFloat64()*20 + 0.01) * float64(time.Millisecond)) }},
+		{"lognormal", 10000, func() time.Duration { return time.Duration(math.Exp(r.NormFloat64()*2+8) * float64(time.Microsecond)) }},
+		{"two peaks", 5000, func() time.Duration {
+			if r.Intn(10) == 0 {
+				return time.Duration(800+r.Intn(400)) * time.Millisecond
+			}
+			return time.Duration(2000+r.Intn(1000)) * time.Microsecond
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := NewLatencyHistogram()
+			values := make([]time.Duration, test.n)
+			for i := range values {
+				values[i] = test.next()
+				h.Add(values[i])
+			}
+			sort.Slice(values, func(a, b int) bool { return values[a] < values[b] })
+
+			for _, q := range []float64{0.5, 0.95, 0.99} {
+				exact := exactQuantile(values, q)
+				got := h.Quantile(q)
+
+				// The middle of a bucket is within the accuracy of anything in it, plus a
+				// nanosecond of rounding to a duration
+				bound := time.Duration(histogramAccuracy*float64(exact)) + time.Nanosecond
+				if diff := got - exact; diff > bound || -diff > bound {
+					t.Errorf("p%v: got %v, exact %v, more than %v apart", q*100, got, exact, bound)
+				}
+			}
+
+			if h.Count != uint64(test.n) || h.Max != values[len(values)-1] {
+				t.Errorf("got count %d and max %v, expected %d and %v", h.Count, h.Max, test.n, values[len(values)-1])
+			}
+		})
+	}
+}
+
+func TestRollupMerge(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Every check counted straight into the hour, and into the minute rollups merged into the hour
+	direct := NewRollup("host", NetworkPublic, CheckTCP, ResolutionHour, start)
+	merged := NewRollup("host", NetworkPublic, CheckTCP, ResolutionHour, start)
+	for minute := 0; minute < 60; minute++ {
+		at := start.Add(time.Duration(minute) * time.Minute)
+		m := NewRollup("host", NetworkPublic, CheckTCP, ResolutionMinute, at)
+		for i := 0; i < 20; i++ {
+			check := Check{
+				Status:       StatusSuccess,
+				ResponseTime: time.Duration(math.Exp(r.NormFloat64()+9) * float64(time.Microsecond)),
+				CheckedAt:    at.Add(time.Duration(i) * time.Second),
+			}
+			if r.Intn(20) == 0 {
+				check.Status = StatusError
+			}
+			m.Add(check)
+			direct.Add(check)
+		}
+		merged.Merge(*m)
+	}
+
+	if merged.Count != direct.Count || merged.Success != direct.Success {
+		t.Errorf("got %d checks and %d successes, expected %d and %d", merged.Count, merged.Success, direct.Count, direct.Success)
+	}
+	if merged.Min != direct.Min || merged.Max != direct.Max || merged.Avg != direct.Avg {
+		t.Errorf("got min/avg/max %v/%v/%v, expected %v/%v/%v", merged.Min, merged.Avg, merged.Max, direct.Min, direct.Avg, direct.Max)
+	}
+	if merged.P50 != direct.P50 || merged.P90 != direct.P90 || merged.P99 != direct.P99 {
+		t.Errorf("got p50/p90/p99 %v/%v/%v, expected %v/%v/%v", merged.P50, merged.P90, merged.P99, direct.P50, direct.P90, direct.P99)
+	}
+	if len(merged.Latency.Buckets) != len(direct.Latency.Buckets) {
+		t.Fatalf("got %d buckets, expected %d", len(merged.Latency.Buckets), len(direct.Latency.Buckets))
+	}
+	for index, count := range direct.Latency.Buckets {
+		if merged.Latency.Buckets[index] != count {
+			t.Errorf("bucket %d: got %d, expected %d", index, merged.Latency.Buckets[index], count)
+		}
+	}
+
+	// Merging an empty rollup or a missing histogram changes nothing
+	before := *merged
+	merged.Merge(*NewRollup("host", NetworkPublic, CheckTCP, ResolutionMinute, start))
+	merged.Latency.Merge(nil)
+	if merged.Count != before.Count || merged.P99 != before.P99 || merged.Min != before.Min {
+		t.Errorf("merging an empty rollup changed it: %+v", merged)
+	}
+}
@@ -1,47 +1,52 @@
 package models
 
 import (
-	"encoding/json"
+	"regexp"
 	"sort"
-	"strings"
 	"time"
-
-	"github.com/dgraph-io/badger"
 )
 
-const (
-	hostsPrefix    = "hosts.id."
-	hostnamePrefix = "hosts.hostname."
-	ipPrefix       = "hosts.ip."
-)
+// intIDRegex matches the integer ids of hosts from versions before ids were strings
+var intIDRegex = regexp.MustCompile(`"(ID|id)":(\d+)`)
 
-type Host struct {
-	ID                string         `json:"id" badgerhold:"key"`
-	CurrentHost       bool           `json:"-"`
-	Hostname          string         `json:"hostname" badgerhold:"unique"`
-	ServiceRestarts   int            `json:"serviceRestarts,omitempty"`
-	ServiceFirstStart time.Time      `json:"serviceFirstStart"`
-	ServiceLastStart  time.Time      `json:"serviceLastStart"`
-	InternalIP        string         `json:"internalIp" badgerhold:"unique"`
-	PublicIP          string         `json:"publicIp" badgerhold:"unique"`
-	DiscoveredIP      string         `json:"-"`
-	ServiceUptime     time.Duration  `json:"serviceUptime,omitempty"`
-	HostUptime        time.Duration  `json:"hostUptime,omitempty"`
-	FirstSeenAt       time.Time      `json:"firstSeenAt"`
-	LastSeenAt        time.Time      `json:"lastSeenAt" badgerhold:"index"`
-	LatestChecks      *ServiceChecks `json:"latestChecks,omitempty"`
-	Checks            *ServiceChecks `json:"checks,omitempty"`
-	CheckUptime       *CheckUptime   `json:"checkUptime"`
-	CityCode          string         `json:"cityCode,omitempty"`
-	Longitude         string         `json:"longitude,omitempty"`
-	Latitude          string         `json:"latitude,omitempty"`
+// UpgradeHostJSON quotes an integer host id so the host can be decoded. Used for the
+// health of peers running old versions and hosts stored before the id was a string.
+func UpgradeHostJSON(data []byte) []byte {
+	return intIDRegex.ReplaceAll(data, []byte(`"${1}":"${2}"`))
 }
 
-type ServiceChecks struct {
-	Internal CheckTypes `json:"internal"`
-	Public   CheckTypes `json:"public"`
+type Host struct {
+	ID                string                     `json:"id" badgerhold:"key"`
+	CurrentHost       bool                       `json:"-"`
+	Hostname          string                     `json:"hostname" badgerhold:"unique"`
+	InstanceID        string                     `json:"instanceId,omitempty"`
+	ServiceRestarts   int                        `json:"serviceRestarts,omitempty"`
+	ServiceFirstStart time.Time                  `json:"serviceFirstStart"`
+	ServiceLastStart  time.Time                  `json:"serviceLastStart"`
+	InternalIP        string                     `json:"internalIp" badgerhold:"unique"`
+	PublicIP          string                     `json:"publicIp" badgerhold:"unique"`
+	Addresses         map[Network]string         `json:"addresses,omitempty"`
+	Labels            map[string]string          `json:"labels,omitempty"`
+	DiscoveredIP      string                     `json:"-"`
+	ServiceUptime     time.Duration              `json:"serviceUptime,omitempty"`
+	HostUptime        time.Duration              `json:"hostUptime,omitempty"`
+	BootedAt          time.Time                  `json:"bootedAt"`
+	Restarts          *RestartCounts             `json:"restarts,omitempty"`
+	FirstSeenAt       time.Time                  `json:"firstSeenAt"`
+	LastSeenAt        time.Time                  `json:"lastSeenAt" badgerhold:"index"`
+	LatestChecks      ServiceChecks              `json:"latestChecks,omitempty"`
+	Checks            ServiceChecks              `json:"checks,omitempty"`
+	CheckUptime       *CheckUptime               `json:"checkUptime"`
+	Inbound           *InboundView               `json:"inbound,omitempty"`
+	Latency           map[Network]NetworkLatency `json:"latency,omitempty"`
+	CityCode          string                     `json:"cityCode,omitempty"`
+	Longitude         string                     `json:"longitude,omitempty"`
+	Latitude          string                     `json:"latitude,omitempty"`
 }
 
+// ServiceChecks holds the checks for each network the host is reachable on
+type ServiceChecks map[Network]*CheckTypes
+
 type CheckTypes struct {
 	HTTP []Check `json:"http"`
 	TCP  []Check `json:"tcp"`
@@ -49,160 +54,124 @@ type CheckTypes struct {
 	ICMP []Check `json:"icmp"`
 }
 
-func GetHostByHostname(db *badger.DB, hostname string) (*Host, error) {
-	var host Host
-	err := db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(hostnamePrefix + hostname))
-		if err != nil {
-			return err
-		}
-
-		var id string
-		item.Value(func(val []byte) error {
-			id = string(val)
-			return nil
-		})
-
-		item, err = txn.Get([]byte(hostsPrefix + id))
-		if err != nil {
-			return err
-		}
-
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &host)
-		})
-	})
-	if err != nil {
-		return nil, err
+// NewServiceChecks always includes internal and public so clients can rely on them being present
+func NewServiceChecks() ServiceChecks {
+	return ServiceChecks{
+		NetworkInternal: &CheckTypes{},
+		NetworkPublic:   &CheckTypes{},
 	}
-
-	return &host, nil
 }
 
-func GetHostByID(db *badger.DB, id string) (*Host, error) {
-	var host Host
-	err := db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(hostsPrefix + id))
-		if err != nil {
-			return err
-		}
-
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &host)
-		})
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	if err := host.addLatestStatuses(db); err != nil {
-		return nil, err
+// Network returns the checks for the network, adding it if it is not present
+func (s ServiceChecks) Network(network Network) *CheckTypes {
+	checks, ok := s[network]
+	if !ok {
+		checks = &CheckTypes{}
+		s[network] = checks
 	}
+	return checks
+}
 
-	if err := host.addChecks(db); err != nil {
-		return nil, err
+// Add appends the check to the list for its type
+func (c *CheckTypes) Add(check Check) {
+	switch check.CheckType {
+	case CheckHTTP:
+		c.HTTP = append(c.HTTP, check)
+	case CheckICMP:
+		c.ICMP = append(c.ICMP, check)
+	case CheckTCP:
+		c.TCP = append(c.TCP, check)
+	case CheckUDP:
+		c.UDP = append(c.UDP, check)
 	}
+}
 
-	if err := host.setUptimes(db); err != nil {
-		return nil, err
+// Set replaces the list for the check's type with only the check
+func (c *CheckTypes) Set(check Check) {
+	switch check.CheckType {
+	case CheckHTTP:
+		c.HTTP = []Check{check}
+	case CheckICMP:
+		c.ICMP = []Check{check}
+	case CheckTCP:
+		c.TCP = []Check{check}
+	case CheckUDP:
+		c.UDP = []Check{check}
 	}
-
-	return &host, nil
 }
 
-func GetHostByIP(db *badger.DB, ip string) (*Host, error) {
-	var host Host
-	err := db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(ipPrefix + ip))
-		if err != nil {
-			return err
-		}
-
-		var id string
-		item.Value(func(val []byte) error {
-			id = string(val)
-			return nil
-		})
-
-		item, err = txn.Get([]byte(hostsPrefix + id))
-		if err != nil {
-			return err
+// NetworkAddresses returns the address of the host on each network it is reachable on
+func (h *Host) NetworkAddresses() map[Network]string {
+	addrs := make(map[Network]string)
+	for network, addr := range h.Addresses {
+		if addr != "" && network.Valid() {
+			addrs[network] = addr
 		}
-
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &host)
-		})
-	})
-	if err != nil {
-		return nil, err
 	}
-
-	return &host, nil
+	if h.InternalIP != "" {
+		addrs[NetworkInternal] = h.InternalIP
+	}
+	if h.PublicIP != "" {
+		addrs[NetworkPublic] = h.PublicIP
+	}
+	return addrs
 }
 
-func GetHostsWithStatuses(db *badger.DB) ([]Host, error) {
-	hosts, err := GetHosts(db)
-	if err != nil {
-		return nil, err
+// Networks returns the networks the host is reachable on sorted by name
+func (h *Host) Networks() []Network {
+	var networks []Network
+	for network := range h.NetworkAddresses() {
+		networks = append(networks, network)
 	}
+	sort.Slice(networks, func(a, b int) bool {
+		return networks[a] < networks[b]
+	})
+	return networks
+}
 
-	for i, host := range hosts {
-		if err := host.addLatestStatuses(db); err != nil {
-			return nil, err
+// NetworkForIP returns the network the ip belongs to, defaulting to public when it is not known
+func (h *Host) NetworkForIP(ip string) Network {
+	for network, addr := range h.NetworkAddresses() {
+		if addr == ip {
+			return network
 		}
+	}
+	return NetworkPublic
+}
 
-		if err := host.setUptimes(db); err != nil {
-			return nil, err
+// HasIP reports if the ip is one of the host's addresses
+func (h *Host) HasIP(ip string) bool {
+	for _, addr := range h.NetworkAddresses() {
+		if addr == ip {
+			return true
 		}
-
-		hosts[i] = host
 	}
-
-	return hosts, nil
+	return false
 }
 
-func GetHosts(db *badger.DB) ([]Host, error) {
-	var hosts []Host
-	err := db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-
-		for it.Seek([]byte(hostsPrefix)); it.ValidForPrefix([]byte(hostsPrefix)); it.Next() {
-			var host Host
-
-			item := it.Item()
-
-			if strings.HasSuffix(string(item.Key()), currentHostID) {
-				continue
-			}
-
-			err := item.Value(func(val []byte) error {
-				if err := json.Unmarshal(val, &host); err != nil {
-					return err
-				}
-
-				hosts = append(hosts, host)
-				return nil
-			})
-			if err != nil {
-				return err
-			}
+// RemoveIP removes the ip from the host's addresses and reports if the host had it
+func (h *Host) RemoveIP(ip string) bool {
+	removed := false
+	if h.InternalIP == ip {
+		h.InternalIP = ""
+		removed = true
+	}
+	if h.PublicIP == ip {
+		h.PublicIP = ""
+		removed = true
+	}
+	for network, addr := range h.Addresses {
+		if addr == ip {
+			delete(h.Addresses, network)
+			removed = true
 		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
 	}
-
-	sort.Slice(hosts, func(a, b int) bool {
-		return sort.StringsAreSorted([]string{hosts[a].Hostname, hosts[b].Hostname})
-	})
-
-	return hosts, nil
+	return removed
 }
 
-func (h *Host) Save(db *badger.DB) error {
+// BeforeSave assigns the host an id when it is new, updates when it was last seen and
+// clears the fields that are loaded from checks and not stored with the host
+func (h *Host) BeforeSave() {
 	h.LastSeenAt = time.Now().UTC()
 	if h.FirstSeenAt.IsZero() {
 		h.FirstSeenAt = time.Now().UTC()
@@ -211,40 +180,19 @@ func (h *Host) Save(db *badger.DB) error {
 	if h.ID == "" {
 		h.ID = getID()
 		if h.CurrentHost {
-			h.ID = currentHostID
+			h.ID = CurrentHostID
 		}
 	}
 	h.Checks = nil
 	h.LatestChecks = nil
 	h.CheckUptime = nil
+	h.Inbound = nil
+	h.Latency = nil
+}
 
-	return db.Update(func(txn *badger.Txn) error {
-		jsonHost, _ := json.Marshal(h)
-		if err := txn.Set([]byte(hostsPrefix+h.ID), jsonHost); err != nil {
-			return err
-		}
-
-		if err := txn.Set([]byte(hostnamePrefix+h.Hostname), []byte(h.ID)); err != nil {
-			return err
-		}
-
-		if h.PublicIP != "" {
-			if err := txn.Set([]byte(ipPrefix+h.PublicIP), []byte(h.ID)); err != nil {
-				return err
-			}
-		}
-
-		if h.InternalIP != "" {
-			if err := txn.Set([]byte(ipPrefix+h.InternalIP), []byte(h.ID)); err != nil {
-				return err
-			}
-		}
-
-		if h.DiscoveredIP != "" {
-			if err := txn.Set([]byte(ipPrefix+h.DiscoveredIP), []byte(h.ID)); err != nil {
-				return err
-			}
-		}
-		return nil
+// SortHosts sorts the hosts by hostname
+func SortHosts(hosts []Host) {
+	sort.Slice(hosts, func(a, b int) bool {
+		return sort.StringsAreSorted([]string{hosts[a].Hostname, hosts[b].Hostname})
 	})
 }
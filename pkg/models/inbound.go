@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// InboundView is what the local service has received from a peer. Comparing it
+// against the outbound checks for the same peer shows one-way reachability
+// problems, e.g. our probes succeed but the peer's probes never arrive.
+type InboundView struct {
+	TCP InboundStats `json:"tcp"`
+	UDP InboundStats `json:"udp"`
+}
+
+type InboundStats struct {
+	Requests   uint64    `json:"requests"`
+	Bytes      uint64    `json:"bytes"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+// Add counts a probe of the given size
+func (s *InboundStats) Add(bytes int) {
+	s.Requests++
+	s.Bytes += uint64(bytes)
+	s.LastSeenAt = time.Now().UTC()
+}
+
+// Merge adds the probes counted in other
+func (s *InboundStats) Merge(other InboundStats) {
+	s.Requests += other.Requests
+	s.Bytes += other.Bytes
+	if other.LastSeenAt.After(s.LastSeenAt) {
+		s.LastSeenAt = other.LastSeenAt
+	}
+}
+
+// Set sets the stats for the check type
+func (v *InboundView) Set(checkType CheckType, stats InboundStats) {
+	switch checkType {
+	case CheckTCP:
+		v.TCP = stats
+	case CheckUDP:
+		v.UDP = stats
+	}
+}
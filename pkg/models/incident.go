@@ -0,0 +1,165 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Incident is a contiguous period where checks of a host on one network kept failing
+type Incident struct {
+	ID         string        `json:"id"`
+	HostID     string        `json:"hostId"`
+	Hostname   string        `json:"hostname"`
+	Network    Network       `json:"network"`
+	CheckTypes []CheckType   `json:"checkTypes"`
+	StartedAt  time.Time     `json:"startedAt"`
+	EndedAt    *time.Time    `json:"endedAt,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Failures   uint64        `json:"failures"`
+	FirstError string        `json:"firstError"`
+	LastError  string        `json:"lastError"`
+}
+
+// NewIncident opens an incident for the host and network starting at start
+func NewIncident(h *Host, network Network, start time.Time) *Incident {
+	return &Incident{
+		ID:        getID(),
+		HostID:    h.ID,
+		Hostname:  h.Hostname,
+		Network:   network,
+		StartedAt: start,
+	}
+}
+
+// Open reports if the checks are still failing
+func (i *Incident) Open() bool {
+	return i.EndedAt == nil
+}
+
+// AddFailure counts a failed check towards the incident
+func (i *Incident) AddFailure(check *Check) {
+	i.Failures++
+	if check.CheckErrorMessage != "" {
+		if i.FirstError == "" {
+			i.FirstError = check.CheckErrorMessage
+		}
+		i.LastError = check.CheckErrorMessage
+	}
+
+	for _, t := range i.CheckTypes {
+		if t == check.CheckType {
+			return
+		}
+	}
+	i.CheckTypes = append(i.CheckTypes, check.CheckType)
+	sort.Slice(i.CheckTypes, func(a, b int) bool {
+		return i.CheckTypes[a] < i.CheckTypes[b]
+	})
+}
+
+// Close ends the incident at end
+func (i *Incident) Close(end time.Time) {
+	i.EndedAt = &end
+	i.Duration = end.Sub(i.StartedAt)
+}
+
+// SetDuration updates the duration of an open incident to now
+func (i *Incident) SetDuration(now time.Time) {
+	if i.Open() {
+		i.Duration = now.Sub(i.StartedAt).Truncate(time.Second)
+	}
+}
+
+// Failed reports if the check counts as a failure. Unknown checks, e.g. ICMP without
+// permission to ping, are not failures.
+func (c *Check) Failed() bool {
+	return c.Status == StatusError || c.Status == StatusIdentityMismatch
+}
+
+// IncidentFilter selects a page of incidents that overlap a time range, most recently
+// started first. Empty fields match everything.
+type IncidentFilter struct {
+	HostID    string
+	Network   Network
+	CheckType CheckType
+	OpenOnly  bool
+	Start     time.Time
+	End       time.Time
+	Limit     int
+	After     *Cursor
+}
+
+// IncidentPage is one page of incidents. Next is empty on the last page.
+type IncidentPage struct {
+	Incidents []Incident `json:"incidents"`
+	Next      string     `json:"next,omitempty"`
+}
+
+// PageLimit is the limit of the filter within the default and max page size
+func (f IncidentFilter) PageLimit() int {
+	if f.Limit <= 0 {
+		return checkLimit
+	}
+	if f.Limit > MaxCheckQueryLimit {
+		return MaxCheckQueryLimit
+	}
+	return f.Limit
+}
+
+// Match reports if the incident is selected by the filter
+func (f IncidentFilter) Match(i Incident) bool {
+	if f.HostID != "" && i.HostID != f.HostID {
+		return false
+	}
+	if f.Network != "" && i.Network != f.Network {
+		return false
+	}
+	if f.OpenOnly && !i.Open() {
+		return false
+	}
+	// Pages go back in time so only incidents ordered before the cursor follow it
+	if f.After != nil && !(&Cursor{At: i.StartedAt, ID: i.ID}).Before(f.After.At, f.After.ID) {
+		return false
+	}
+	if !f.End.IsZero() && !i.StartedAt.Before(f.End) {
+		return false
+	}
+	if !f.Start.IsZero() && !i.Open() && i.EndedAt.Before(f.Start) {
+		return false
+	}
+	if f.CheckType != "" {
+		for _, t := range i.CheckTypes {
+			if t == f.CheckType {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Page sorts the matched incidents and cuts them to the limit of the filter
+func (f IncidentFilter) Page(incidents []Incident) *IncidentPage {
+	SortIncidents(incidents)
+
+	page := &IncidentPage{Incidents: incidents}
+	if limit := f.PageLimit(); len(incidents) > limit {
+		page.Incidents = incidents[:limit]
+		last := page.Incidents[limit-1]
+		page.Next = (&Cursor{At: last.StartedAt, ID: last.ID}).String()
+	}
+	if page.Incidents == nil {
+		page.Incidents = []Incident{}
+	}
+	return page
+}
+
+// SortIncidents orders the incidents with the most recently started first, then by id
+func SortIncidents(incidents []Incident) {
+	sort.Slice(incidents, func(a, b int) bool {
+		if !incidents[a].StartedAt.Equal(incidents[b].StartedAt) {
+			return incidents[a].StartedAt.After(incidents[b].StartedAt)
+		}
+		return incidents[a].ID > incidents[b].ID
+	})
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// LatencyStats are the latency percentiles of successful checks over a window
+type LatencyStats struct {
+	Count uint64        `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// NetworkLatency is keyed by the lowercase check type and then the window, e.g. latency["tcp"]["1h"]
+type NetworkLatency map[string]map[string]LatencyStats
+
+type latencyKey struct {
+	network   Network
+	checkType CheckType
+	window    string
+}
+
+// LatencyBuilder merges the histograms of rollups into one per network, check type and window
+type LatencyBuilder struct {
+	histograms map[latencyKey]*LatencyHistogram
+}
+
+func NewLatencyBuilder() *LatencyBuilder {
+	return &LatencyBuilder{
+		histograms: make(map[latencyKey]*LatencyHistogram),
+	}
+}
+
+// Add merges the rollup into the window
+func (b *LatencyBuilder) Add(window string, r Rollup) {
+	key := latencyKey{network: r.Network, checkType: r.CheckType, window: window}
+	h, ok := b.histograms[key]
+	if !ok {
+		h = NewLatencyHistogram()
+		b.histograms[key] = h
+	}
+	h.Merge(r.Latency)
+}
+
+// Build returns the percentiles of every network, check type and window that had rollups
+func (b *LatencyBuilder) Build() map[Network]NetworkLatency {
+	latency := make(map[Network]NetworkLatency)
+	for key, h := range b.histograms {
+		network, ok := latency[key.network]
+		if !ok {
+			network = make(NetworkLatency)
+			latency[key.network] = network
+		}
+
+		checkType := strings.ToLower(string(key.checkType))
+		if network[checkType] == nil {
+			network[checkType] = make(map[string]LatencyStats)
+		}
+
+		network[checkType][key.window] = LatencyStats{
+			Count: h.Count,
+			P50:   h.Quantile(0.5),
+			P90:   h.Quantile(0.9),
+			P99:   h.Quantile(0.99),
+			Max:   h.Max,
+		}
+	}
+	return latency
+}
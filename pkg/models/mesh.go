@@ -0,0 +1,147 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	MeshUp       = "up"
+	MeshDown     = "down"
+	MeshDegraded = "degraded"
+	MeshUnknown  = "unknown"
+
+	// meshWindow is the window loss and latency of the cells are over
+	meshWindow = "1h"
+)
+
+// MeshMatrix is the latest results of every node against every other node on each network
+type MeshMatrix struct {
+	GeneratedAt time.Time    `json:"generatedAt"`
+	Nodes       []string     `json:"nodes"`
+	Sources     []MeshSource `json:"sources"`
+	Cells       []MeshCell   `json:"cells"`
+}
+
+// MeshSource is a node the results were collected from. Unreachable sources have no cells.
+type MeshSource struct {
+	Hostname  string    `json:"hostname"`
+	HostID    string    `json:"hostId,omitempty"`
+	Reachable bool      `json:"reachable"`
+	Error     string    `json:"error,omitempty"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// MeshCell is the results of the checks from a source to a destination on a network. Loss
+// is the share of failed checks and latency the p50 of each check type over the last hour.
+type MeshCell struct {
+	Source      string                   `json:"source"`
+	Destination string                   `json:"destination"`
+	Network     Network                  `json:"network"`
+	Status      string                   `json:"status"`
+	Loss        *float64                 `json:"loss,omitempty"`
+	Latency     map[string]time.Duration `json:"latency,omitempty"`
+	Checks      map[string]Status        `json:"checks"`
+}
+
+// MeshResults is the results of a node against one destination. Known is false when the
+// node doesn't check a host with the destination's hostname.
+type MeshResults struct {
+	Source      string     `json:"source"`
+	Destination string     `json:"destination"`
+	Known       bool       `json:"known"`
+	Cells       []MeshCell `json:"cells"`
+}
+
+// MeshCells returns the cells of the hosts as seen from source, with their latest checks,
+// uptime and latency loaded
+func MeshCells(source string, hosts []Host) []MeshCell {
+	var cells []MeshCell
+	for _, h := range hosts {
+		for _, network := range h.Networks() {
+			cell := MeshCell{
+				Source:      source,
+				Destination: h.Hostname,
+				Network:     network,
+				Status:      MeshUnknown,
+				Checks:      make(map[string]Status),
+			}
+
+			var up, down int
+			if checks, ok := h.LatestChecks[network]; ok {
+				for _, list := range [][]Check{checks.HTTP, checks.TCP, checks.UDP, checks.ICMP} {
+					if len(list) == 0 {
+						continue
+					}
+					latest := list[len(list)-1]
+					cell.Checks[strings.ToLower(string(latest.CheckType))] = latest.Status
+					switch {
+					case latest.Failed():
+						down++
+					case latest.Status != StatusUnknown:
+						up++
+					}
+				}
+			}
+			switch {
+			case up > 0 && down > 0:
+				cell.Status = MeshDegraded
+			case up > 0:
+				cell.Status = MeshUp
+			case down > 0:
+				cell.Status = MeshDown
+			}
+
+			if h.CheckUptime != nil {
+				if uptime, ok := h.CheckUptime.Networks[network]; ok {
+					if counts := uptime.Windows[meshWindow]; counts.TotalChecks > 0 {
+						loss := 1 - float64(counts.TotalSuccess)/float64(counts.TotalChecks)
+						cell.Loss = &loss
+					}
+				}
+			}
+
+			for checkType, windows := range h.Latency[network] {
+				if stats, ok := windows[meshWindow]; ok && stats.Count > 0 {
+					if cell.Latency == nil {
+						cell.Latency = make(map[string]time.Duration)
+					}
+					cell.Latency[checkType] = stats.P50
+				}
+			}
+			cells = append(cells, cell)
+		}
+	}
+	return cells
+}
+
+// Sort sorts the nodes, sources and cells of the matrix by hostname
+func (m *MeshMatrix) Sort() {
+	nodes := make(map[string]bool)
+	for _, s := range m.Sources {
+		nodes[s.Hostname] = true
+	}
+	for _, c := range m.Cells {
+		nodes[c.Destination] = true
+	}
+	m.Nodes = make([]string, 0, len(nodes))
+	for node := range nodes {
+		m.Nodes = append(m.Nodes, node)
+	}
+	sort.Strings(m.Nodes)
+
+	sort.Slice(m.Sources, func(a, b int) bool {
+		return m.Sources[a].Hostname < m.Sources[b].Hostname
+	})
+	sort.Slice(m.Cells, func(a, b int) bool {
+		ca, cb := m.Cells[a], m.Cells[b]
+		if ca.Source != cb.Source {
+			return ca.Source < cb.Source
+		}
+		if ca.Destination != cb.Destination {
+			return ca.Destination < cb.Destination
+		}
+		return ca.Network < cb.Network
+	})
+}
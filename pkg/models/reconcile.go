@@ -0,0 +1,121 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// ReconcileReport is the result of a reconciliation of the known hosts
+type ReconcileReport struct {
+	StartedAt      time.Time    `json:"startedAt"`
+	Merged         []MergedHost `json:"merged"`
+	IndexesRemoved int          `json:"indexesRemoved"`
+	IndexesMoved   int          `json:"indexesMoved"`
+}
+
+// MergedHost is a host that the duplicate records of the same node were merged into
+type MergedHost struct {
+	ID         string   `json:"id"`
+	Hostname   string   `json:"hostname"`
+	Duplicates []string `json:"duplicates"`
+}
+
+// SameNode reports if both hosts are records of the same node. A replaced or restarted
+// container keeps its hostname and address but gets a new instance id, so the hostname with
+// a shared address decides first. The instance id only breaks ties when they don't both
+// match, then the hostname alone, then a shared address.
+func (h *Host) SameNode(other *Host) bool {
+	sameHostname := h.Hostname != "" && h.Hostname == other.Hostname
+	shared := h.sharesAddress(other)
+	if sameHostname && shared {
+		return true
+	}
+
+	if h.InstanceID != "" && other.InstanceID != "" {
+		return h.InstanceID == other.InstanceID
+	}
+	if h.Hostname != "" && other.Hostname != "" {
+		return sameHostname
+	}
+	return shared
+}
+
+// sharesAddress reports if the hosts have an address in common
+func (h *Host) sharesAddress(other *Host) bool {
+	addrs := other.NetworkAddresses()
+	for _, addr := range h.NetworkAddresses() {
+		for _, otherAddr := range addrs {
+			if addr == otherAddr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FindDuplicates groups the hosts that are records of the same node. Only groups with
+// more than one host are returned.
+func FindDuplicates(hosts []Host) [][]Host {
+	group := make([]int, len(hosts))
+	for i := range group {
+		group[i] = i
+	}
+
+	for i := range hosts {
+		for j := i + 1; j < len(hosts); j++ {
+			if group[j] != j || !hosts[i].SameNode(&hosts[j]) {
+				continue
+			}
+			group[j] = group[i]
+		}
+	}
+
+	byGroup := make(map[int][]Host)
+	for i, g := range group {
+		byGroup[g] = append(byGroup[g], hosts[i])
+	}
+
+	var duplicates [][]Host
+	for i := range hosts {
+		if len(byGroup[i]) > 1 {
+			duplicates = append(duplicates, byGroup[i])
+		}
+	}
+	return duplicates
+}
+
+// MergeDuplicates combines the records of one node. The id of the first seen record is
+// kept so links to it keep working, and the hostname, addresses and instance of the most
+// recently seen record are used. The ids of the other records are returned.
+func MergeDuplicates(hosts []Host) (Host, []string) {
+	sort.Slice(hosts, func(a, b int) bool {
+		return hosts[a].FirstSeenAt.Before(hosts[b].FirstSeenAt)
+	})
+	first := hosts[0]
+
+	latest := first
+	for _, h := range hosts[1:] {
+		if h.LastSeenAt.After(latest.LastSeenAt) {
+			latest = h
+		}
+	}
+
+	merged := latest
+	merged.ID = first.ID
+	merged.FirstSeenAt = first.FirstSeenAt
+
+	var duplicates []string
+	for i, h := range hosts {
+		if i > 0 {
+			duplicates = append(duplicates, h.ID)
+		}
+
+		if !h.ServiceFirstStart.IsZero() && h.ServiceFirstStart.Before(merged.ServiceFirstStart) {
+			merged.ServiceFirstStart = h.ServiceFirstStart
+		}
+		if h.ServiceRestarts > merged.ServiceRestarts {
+			merged.ServiceRestarts = h.ServiceRestarts
+		}
+	}
+	return merged, duplicates
+}
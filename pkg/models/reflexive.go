@@ -0,0 +1,129 @@
+package models
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	NATUnknown             NATType = "unknown"
+	NATNone                NATType = "none"
+	NATEndpointIndependent NATType = "endpoint-independent"
+	NATEndpointDependent   NATType = "endpoint-dependent"
+)
+
+type NATType string
+
+// ReflexiveObservation is the address a peer saw our traffic coming from
+type ReflexiveObservation struct {
+	HostID       string    `json:"hostId"`
+	Hostname     string    `json:"hostname"`
+	Network      Network   `json:"network"`
+	CheckType    CheckType `json:"checkType"`
+	LocalPort    int       `json:"localPort"`
+	ObservedIP   string    `json:"observedIp"`
+	ObservedPort int       `json:"observedPort"`
+	ObservedAt   time.Time `json:"observedAt"`
+}
+
+// ReflexiveAddress is the current host's address and NAT behavior as seen by its peers
+type ReflexiveAddress struct {
+	PublicIP     string                 `json:"publicIp"`
+	NATType      NATType                `json:"natType"`
+	Peers        int                    `json:"peers"`
+	Observations []ReflexiveObservation `json:"observations"`
+}
+
+// NewReflexiveObservation builds an observation from the "ip:port" string a peer returned
+func NewReflexiveObservation(h *Host, network Network, checkType CheckType, localPort int, observed string) (*ReflexiveObservation, error) {
+	ip, portStr, err := net.SplitHostPort(observed)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReflexiveObservation{
+		HostID:       h.ID,
+		Hostname:     h.Hostname,
+		Network:      network,
+		CheckType:    checkType,
+		LocalPort:    localPort,
+		ObservedIP:   ip,
+		ObservedPort: port,
+		ObservedAt:   time.Now().UTC(),
+	}, nil
+}
+
+// NewReflexiveAddress combines the recent observations from every peer into the address
+// most peers see and the NAT mapping behavior. The mapping is endpoint independent when
+// every peer saw the same port for traffic sent from the same local UDP port.
+func NewReflexiveAddress(observations []ReflexiveObservation, current *Host) *ReflexiveAddress {
+	addr := &ReflexiveAddress{
+		NATType:      NATUnknown,
+		Observations: observations,
+	}
+	if addr.Observations == nil {
+		addr.Observations = []ReflexiveObservation{}
+	}
+
+	peers := make(map[string]bool)
+	ipCounts := make(map[string]int)
+	for _, o := range addr.Observations {
+		peers[o.HostID] = true
+		if o.Network == NetworkPublic {
+			ipCounts[o.ObservedIP]++
+		}
+	}
+	addr.Peers = len(peers)
+
+	for ip, count := range ipCounts {
+		if count > ipCounts[addr.PublicIP] {
+			addr.PublicIP = ip
+		}
+	}
+
+	addr.NATType = natType(addr.Observations, current)
+	return addr
+}
+
+func natType(observations []ReflexiveObservation, current *Host) NATType {
+	// Only the newest local port matters, older ones are from before a restart
+	var latest *ReflexiveObservation
+	for i, o := range observations {
+		if o.Network != NetworkPublic || o.CheckType != CheckUDP {
+			continue
+		}
+		if latest == nil || o.ObservedAt.After(latest.ObservedAt) {
+			latest = &observations[i]
+		}
+	}
+	if latest == nil {
+		return NATUnknown
+	}
+
+	peers := make(map[string]bool)
+	mappings := make(map[string]bool)
+	for _, o := range observations {
+		if o.Network != NetworkPublic || o.CheckType != CheckUDP || o.LocalPort != latest.LocalPort {
+			continue
+		}
+		peers[o.HostID] = true
+		mappings[net.JoinHostPort(o.ObservedIP, strconv.Itoa(o.ObservedPort))] = true
+	}
+
+	switch {
+	case len(mappings) > 1:
+		return NATEndpointDependent
+	case current != nil && latest.ObservedIP == current.PublicIP && latest.ObservedPort == latest.LocalPort:
+		return NATNone
+	case len(peers) < 2:
+		return NATUnknown
+	default:
+		return NATEndpointIndependent
+	}
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// bootTolerance is how much later a reported boot time can be before it is counted as a
+// reboot, as it is calculated from an uptime in seconds and the time of the check
+const bootTolerance = time.Minute
+
+type RestartKind string
+
+const (
+	RestartNone RestartKind = ""
+	// RestartService is the service or its container restarting while the host kept running
+	RestartService RestartKind = "service"
+	// RestartHost is the host rebooting, which restarts the service as well
+	RestartHost RestartKind = "host"
+)
+
+// RestartCounts are the restarts of a peer seen by this node
+type RestartCounts struct {
+	Service       int        `json:"service"`
+	Host          int        `json:"host"`
+	LastServiceAt *time.Time `json:"lastServiceAt,omitempty"`
+	LastHostAt    *time.Time `json:"lastHostAt,omitempty"`
+}
+
+// Add counts a restart of the kind that happened at
+func (r *RestartCounts) Add(kind RestartKind, at time.Time) {
+	switch kind {
+	case RestartService:
+		r.Service++
+		r.LastServiceAt = &at
+	case RestartHost:
+		r.Host++
+		r.LastHostAt = &at
+	}
+}
+
+// ReportedBootTime is when the host booted. Peers that don't report it have it
+// calculated from their host uptime when they were checked.
+func (h *Host) ReportedBootTime(checkedAt time.Time) time.Time {
+	if !h.BootedAt.IsZero() || h.HostUptime == 0 {
+		return h.BootedAt
+	}
+	return checkedAt.Add(-h.HostUptime).Truncate(time.Second)
+}
+
+// DetectRestart compares what a peer reports with the stored host. A later service start
+// is a restart of the service, unless the host booted again as well.
+func (h *Host) DetectRestart(reported *Host, checkedAt time.Time) RestartKind {
+	bootedAt := reported.ReportedBootTime(checkedAt)
+	if !h.BootedAt.IsZero() && bootedAt.After(h.BootedAt.Add(bootTolerance)) {
+		return RestartHost
+	}
+
+	if !h.ServiceLastStart.IsZero() && reported.ServiceLastStart.After(h.ServiceLastStart) {
+		return RestartService
+	}
+	return RestartNone
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	ResolutionMinute Resolution = "minute"
+	ResolutionHour   Resolution = "hour"
+	ResolutionDay    Resolution = "day"
+)
+
+// Resolution is the size of the window a rollup covers
+type Resolution string
+
+// Resolutions are ordered from the finest to the coarsest
+var Resolutions = []Resolution{ResolutionMinute, ResolutionHour, ResolutionDay}
+
+// Duration is the length of the window
+func (r Resolution) Duration() time.Duration {
+	switch r {
+	case ResolutionMinute:
+		return time.Minute
+	case ResolutionHour:
+		return time.Hour
+	case ResolutionDay:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// Rollup summarizes the checks of one type on one network of a host over a window
+type Rollup struct {
+	HostID     string            `json:"hostId"`
+	Network    Network           `json:"network"`
+	CheckType  CheckType         `json:"checkType"`
+	Resolution Resolution        `json:"resolution"`
+	Start      time.Time         `json:"start"`
+	Count      uint64            `json:"count"`
+	Success    uint64            `json:"success"`
+	Min        time.Duration     `json:"min"`
+	Avg        time.Duration     `json:"avg"`
+	Max        time.Duration     `json:"max"`
+	P50        time.Duration     `json:"p50"`
+	P90        time.Duration     `json:"p90"`
+	P99        time.Duration     `json:"p99"`
+	Sum        time.Duration     `json:"sum"`
+	Latency    *LatencyHistogram `json:"latency"`
+}
+
+// NewRollup returns an empty rollup for the window containing t
+func NewRollup(hostID string, network Network, checkType CheckType, resolution Resolution, t time.Time) *Rollup {
+	return &Rollup{
+		HostID:     hostID,
+		Network:    network,
+		CheckType:  checkType,
+		Resolution: resolution,
+		Start:      t.UTC().Truncate(resolution.Duration()),
+		Latency:    NewLatencyHistogram(),
+	}
+}
+
+// Add counts the check. Only successful checks count towards the latency
+// since failures report the time until the timeout.
+func (r *Rollup) Add(check Check) {
+	r.Count++
+	if check.Status != StatusSuccess {
+		r.setStats()
+		return
+	}
+
+	r.Success++
+	r.Sum += check.ResponseTime
+	if r.Success == 1 || check.ResponseTime < r.Min {
+		r.Min = check.ResponseTime
+	}
+	r.Latency.Add(check.ResponseTime)
+	r.setStats()
+}
+
+// Merge adds a rollup of a finer resolution inside the window
+func (r *Rollup) Merge(other Rollup) {
+	if other.Success > 0 && (r.Success == 0 || other.Min < r.Min) {
+		r.Min = other.Min
+	}
+	r.Count += other.Count
+	r.Success += other.Success
+	r.Sum += other.Sum
+	r.Latency.Merge(other.Latency)
+	r.setStats()
+}
+
+func (r *Rollup) setStats() {
+	r.Max = r.Latency.Max
+	r.P50 = r.Latency.Quantile(0.5)
+	r.P90 = r.Latency.Quantile(0.9)
+	r.P99 = r.Latency.Quantile(0.99)
+	if r.Success > 0 {
+		r.Avg = r.Sum / time.Duration(r.Success)
+	}
+}
+
+// RollupFilter selects the rollups of a host in a time range, optionally limited to a network and check type
+type RollupFilter struct {
+	HostID     string
+	Resolution Resolution
+	Network    Network
+	CheckType  CheckType
+	Start      time.Time
+	End        time.Time
+}
+
+// Match reports if the rollup is selected by the filter
+func (f RollupFilter) Match(r Rollup) bool {
+	if f.HostID != "" && r.HostID != f.HostID {
+		return false
+	}
+	if f.Resolution != "" && r.Resolution != f.Resolution {
+		return false
+	}
+	if f.Network != "" && r.Network != f.Network {
+		return false
+	}
+	if f.CheckType != "" && r.CheckType != f.CheckType {
+		return false
+	}
+	return f.MatchStart(r.Start)
+}
+
+// MatchStart reports if a window starting at t is in the filter's time range.
+// A window is included if the start of the range falls inside it.
+func (f RollupFilter) MatchStart(t time.Time) bool {
+	if !f.Start.IsZero() && t.Before(f.Start.Truncate(f.Resolution.Duration())) {
+		return false
+	}
+	if !f.End.IsZero() && !t.Before(f.End) {
+		return false
+	}
+	return true
+}
+
+// SortRollups orders the rollups by start time, then network and check type
+func SortRollups(rollups []Rollup) {
+	sort.Slice(rollups, func(a, b int) bool {
+		if !rollups[a].Start.Equal(rollups[b].Start) {
+			return rollups[a].Start.Before(rollups[b].Start)
+		}
+		if rollups[a].Network != rollups[b].Network {
+			return rollups[a].Network < rollups[b].Network
+		}
+		return rollups[a].CheckType < rollups[b].CheckType
+	})
+}
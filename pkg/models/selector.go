@@ -0,0 +1,110 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+type selectorOp string
+
+const (
+	selectorEquals    selectorOp = "="
+	selectorNotEquals selectorOp = "!="
+	selectorExists    selectorOp = "exists"
+	selectorNotExists selectorOp = "!exists"
+)
+
+type requirement struct {
+	key   string
+	op    selectorOp
+	value string
+}
+
+// Selector matches hosts by their labels. An empty selector matches every host.
+type Selector struct {
+	requirements []requirement
+}
+
+// ParseSelector parses a comma separated list of requirements that must all match:
+// key=value, key!=value, key (the label is set) and !key (the label is not set)
+func ParseSelector(s string) (Selector, error) {
+	var selector Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var r requirement
+		switch {
+		case strings.Contains(part, "!="):
+			parts := strings.SplitN(part, "!=", 2)
+			r = requirement{key: parts[0], op: selectorNotEquals, value: parts[1]}
+		case strings.Contains(part, "="):
+			parts := strings.SplitN(part, "=", 2)
+			r = requirement{key: parts[0], op: selectorEquals, value: parts[1]}
+		case strings.HasPrefix(part, "!"):
+			r = requirement{key: part[1:], op: selectorNotExists}
+		default:
+			r = requirement{key: part, op: selectorExists}
+		}
+
+		r.key = strings.TrimSpace(r.key)
+		r.value = strings.TrimSpace(r.value)
+		if r.key == "" {
+			return Selector{}, fmt.Errorf("invalid selector %q, missing label key", part)
+		}
+		// Labels can't have these in their key or value, so the requirement is a typo such as !key=value
+		if strings.ContainsAny(r.key, "!= \t") || strings.ContainsAny(r.value, "!= \t") {
+			return Selector{}, fmt.Errorf("invalid selector %q", part)
+		}
+		selector.requirements = append(selector.requirements, r)
+	}
+	return selector, nil
+}
+
+// Empty reports if the selector matches every host
+func (s Selector) Empty() bool {
+	return len(s.requirements) == 0
+}
+
+// Matches reports if the labels meet every requirement of the selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s.requirements {
+		value, ok := labels[r.key]
+		switch r.op {
+		case selectorEquals:
+			if !ok || value != r.value {
+				return false
+			}
+		case selectorNotEquals:
+			if ok && value == r.value {
+				return false
+			}
+		case selectorExists:
+			if !ok {
+				return false
+			}
+		case selectorNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// FilterHosts returns the hosts matched by the selector
+func (s Selector) FilterHosts(hosts []Host) []Host {
+	if s.Empty() {
+		return hosts
+	}
+
+	var matched []Host
+	for _, h := range hosts {
+		if s.Matches(h.Labels) {
+			matched = append(matched, h)
+		}
+	}
+	return matched
+}
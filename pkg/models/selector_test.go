@@ -0,0 +1,89 @@
+package models
+
+import "testing"
+
+func TestParseSelector(t *testing.T) {
+	labels := map[string]string{"provider": "aws", "region": "us-east", "pop": "ams"}
+
+	tests := []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{" , ", true},
+		{"region=us-east", true},
+		{"region=eu-west", false},
+		{" region = us-east ", true},
+		{"region=", false},
+
+		// Negation
+		{"region!=eu-west", true},
+		{"region!=us-east", false},
+		{"!workload", true},
+		{"!region", false},
+		{"region", true},
+
+		// Every term must match
+		{"provider=aws,region=us-east", true},
+		{"provider=aws,region=eu-west", false},
+		{"provider!=gcp,!workload,pop", true},
+		{"provider=aws,region", true},
+		{"provider=aws,!pop", false},
+
+		// Keys no host has
+		{"workload=edge", false},
+		{"workload!=edge", true},
+		{"workload", false},
+	}
+
+	for _, test := range tests {
+		s, err := ParseSelector(test.selector)
+		if err != nil {
+			t.Errorf("%q: %v", test.selector, err)
+			continue
+		}
+		if got := s.Matches(labels); got != test.matches {
+			t.Errorf("%q: expected match %v, got %v", test.selector, test.matches, got)
+		}
+	}
+}
+
+func TestParseSelectorMalformed(t *testing.T) {
+	for _, selector := range []string{
+		"=aws",
+		"!=aws",
+		"!",
+		"region=us-east,=aws",
+		"!region=us-east",
+		"region==us-east",
+		"region=us=east",
+		"region!=!us-east",
+		"cluster name=a",
+	} {
+		if _, err := ParseSelector(selector); err == nil {
+			t.Errorf("%q: expected an error", selector)
+		}
+	}
+}
+
+func TestSelectorFilterHosts(t *testing.T) {
+	hosts := []Host{
+		{Hostname: "a", Labels: map[string]string{"region": "us-east"}},
+		{Hostname: "b", Labels: map[string]string{"region": "eu-west"}},
+		{Hostname: "c"},
+	}
+
+	s, err := ParseSelector("region!=us-east")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.FilterHosts(hosts)
+	if len(got) != 2 || got[0].Hostname != "b" || got[1].Hostname != "c" {
+		t.Errorf("expected the hosts without region us-east, got %+v", got)
+	}
+
+	empty, _ := ParseSelector("")
+	if got := empty.FilterHosts(hosts); len(got) != len(hosts) {
+		t.Errorf("expected an empty selector to keep every host, got %d", len(got))
+	}
+}
@@ -2,10 +2,7 @@ package models
 
 import (
 	"encoding/json"
-	"fmt"
-	"strings"
-
-	"github.com/dgraph-io/badger"
+	"time"
 )
 
 type Uptime interface {
@@ -14,123 +11,231 @@ type Uptime interface {
 	setPercent()
 }
 
-type CheckUptime struct {
-	Percent      float64            `json:"percent"`
-	TotalSuccess uint64             `json:"totalSuccess"`
-	TotalChecks  uint64             `json:"totalChecks"`
-	Internal     CheckNetworkUptime `json:"internal"`
-	Public       CheckNetworkUptime `json:"public"`
+// UptimeWindow is a rolling window uptime is reported for. The window is made up of the
+// buckets of its resolution that started within it, so it covers between its duration less
+// one bucket and its duration, never more.
+type UptimeWindow struct {
+	Name       string
+	Duration   time.Duration
+	Resolution Resolution
 }
 
-type CheckNetworkUptime struct {
-	Percent      float64           `json:"percent"`
-	TotalSuccess uint64            `json:"totalSuccess"`
-	TotalChecks  uint64            `json:"totalChecks"`
-	HTTP         CheckUptimeByType `json:"http"`
-	TCP          CheckUptimeByType `json:"tcp"`
-	UDP          CheckUptimeByType `json:"udp"`
-	ICMP         CheckUptimeByType `json:"icmp"`
+// UptimeWindows are the windows reported for every host, network and check type
+var UptimeWindows = []UptimeWindow{
+	{Name: "1h", Duration: time.Hour, Resolution: ResolutionMinute},
+	{Name: "24h", Duration: 24 * time.Hour, Resolution: ResolutionHour},
+	{Name: "7d", Duration: 7 * 24 * time.Hour, Resolution: ResolutionDay},
+	{Name: "30d", Duration: 30 * 24 * time.Hour, Resolution: ResolutionDay},
 }
 
-type CheckUptimeByType struct {
+// DefaultUptimeWindow is the window used for the percent and totals next to the windows
+const DefaultUptimeWindow = "24h"
+
+// UptimeBucket counts the checks of one type on one network of a host in a window of its resolution
+type UptimeBucket struct {
+	Network      Network    `json:"network"`
+	CheckType    CheckType  `json:"checkType"`
+	Resolution   Resolution `json:"resolution"`
+	Start        time.Time  `json:"start"`
+	TotalSuccess uint64     `json:"totalSuccess"`
+	TotalChecks  uint64     `json:"totalChecks"`
+}
+
+// UptimeBuckets returns the empty buckets of every resolution the check is counted in
+func UptimeBuckets(check *Check) []UptimeBucket {
+	buckets := make([]UptimeBucket, 0, len(Resolutions))
+	for _, resolution := range Resolutions {
+		buckets = append(buckets, UptimeBucket{
+			Network:    check.Network,
+			CheckType:  check.CheckType,
+			Resolution: resolution,
+			Start:      check.CheckedAt.UTC().Truncate(resolution.Duration()),
+		})
+	}
+	return buckets
+}
+
+// Add counts the check in the bucket
+func (b *UptimeBucket) Add(check *Check) {
+	b.TotalChecks++
+	if check.Status == StatusSuccess {
+		b.TotalSuccess++
+	}
+}
+
+// Merge adds the checks counted in other for the same window
+func (b *UptimeBucket) Merge(other UptimeBucket) {
+	b.TotalChecks += other.TotalChecks
+	b.TotalSuccess += other.TotalSuccess
+}
+
+// Retention is how long the bucket is needed for the longest window of its resolution
+func (b *UptimeBucket) Retention() time.Duration {
+	var retention time.Duration
+	for _, w := range UptimeWindows {
+		if w.Resolution == b.Resolution && w.Duration > retention {
+			retention = w.Duration
+		}
+	}
+	return retention + b.Resolution.Duration()
+}
+
+type UptimeCounts struct {
 	Percent      float64 `json:"percent"`
 	TotalSuccess uint64  `json:"totalSuccess"`
 	TotalChecks  uint64  `json:"totalChecks"`
 }
 
-func (h *Host) updateUptime(db *badger.DB, check *Check) error {
-	return db.Update(func(txn *badger.Txn) error {
-		key := fmt.Sprintf("uptime.%s.%s.%s", h.ID, check.Network, check.CheckType)
+func (c *UptimeCounts) add(success, total uint64) {
+	c.TotalSuccess += success
+	c.TotalChecks += total
+	if c.TotalChecks > 0 {
+		c.Percent = (float64(c.TotalSuccess) / float64(c.TotalChecks)) * 100
+	}
+}
 
-		// Get the previous uptime data if it exists
-		item, err := txn.Get([]byte(key))
-		if err != nil && err != badger.ErrKeyNotFound {
-			return err
+// UptimeWindowCounts holds the counts of each window by name
+type UptimeWindowCounts map[string]UptimeCounts
+
+func newUptimeWindowCounts() UptimeWindowCounts {
+	windows := make(UptimeWindowCounts)
+	for _, w := range UptimeWindows {
+		windows[w.Name] = UptimeCounts{}
+	}
+	return windows
+}
+
+func (w UptimeWindowCounts) add(name string, success, total uint64) {
+	counts := w[name]
+	counts.add(success, total)
+	w[name] = counts
+}
+
+// CheckUptime is the uptime of a host across all networks. Each network is
+// encoded next to the totals, e.g. {"percent": 99.5, "windows": {...}, "public": {...}}
+type CheckUptime struct {
+	UptimeCounts
+	Windows  UptimeWindowCounts              `json:"windows"`
+	Networks map[Network]*CheckNetworkUptime `json:"-"`
+}
+
+type CheckNetworkUptime struct {
+	UptimeCounts
+	Windows UptimeWindowCounts `json:"windows"`
+	HTTP    CheckUptimeByType  `json:"http"`
+	TCP     CheckUptimeByType  `json:"tcp"`
+	UDP     CheckUptimeByType  `json:"udp"`
+	ICMP    CheckUptimeByType  `json:"icmp"`
+}
+
+type CheckUptimeByType struct {
+	UptimeCounts
+	Windows UptimeWindowCounts `json:"windows"`
+}
+
+// NewCheckUptime always includes internal and public so clients can rely on them being present
+func NewCheckUptime() *CheckUptime {
+	u := &CheckUptime{
+		Windows:  newUptimeWindowCounts(),
+		Networks: make(map[Network]*CheckNetworkUptime),
+	}
+	u.network(NetworkInternal)
+	u.network(NetworkPublic)
+	return u
+}
+
+// AddBucket counts the bucket towards every window it is in at now
+func (u *CheckUptime) AddBucket(b UptimeBucket, now time.Time) {
+	network := u.network(b.Network)
+	byType := network.checkType(b.CheckType)
+
+	for _, w := range UptimeWindows {
+		// The oldest bucket is left out when it started before the window, as its checks
+		// can't be split to count only the part within it
+		if w.Resolution != b.Resolution || b.Start.Before(now.Add(-w.Duration)) {
+			continue
 		}
 
-		var uptime CheckUptimeByType
+		u.Windows.add(w.Name, b.TotalSuccess, b.TotalChecks)
+		network.Windows.add(w.Name, b.TotalSuccess, b.TotalChecks)
+		byType.Windows.add(w.Name, b.TotalSuccess, b.TotalChecks)
 
-		// If a record was found then get the existing uptime metrics from it
-		if item != nil {
-			err := item.Value(func(val []byte) error {
-				return json.Unmarshal(val, &uptime)
-			})
-			if err != nil {
-				return err
-			}
+		if w.Name == DefaultUptimeWindow {
+			u.add(b.TotalSuccess, b.TotalChecks)
+			network.add(b.TotalSuccess, b.TotalChecks)
+			byType.add(b.TotalSuccess, b.TotalChecks)
 		}
+	}
+}
 
-		// Increment the counters and calculate the percent
-		uptime.TotalChecks++
-		if check.Status == StatusSuccess {
-			uptime.TotalSuccess++
+func (u *CheckUptime) network(network Network) *CheckNetworkUptime {
+	if u.Networks == nil {
+		u.Networks = make(map[Network]*CheckNetworkUptime)
+	}
+
+	uptime, ok := u.Networks[network]
+	if !ok {
+		uptime = &CheckNetworkUptime{
+			Windows: newUptimeWindowCounts(),
+			HTTP:    CheckUptimeByType{Windows: newUptimeWindowCounts()},
+			TCP:     CheckUptimeByType{Windows: newUptimeWindowCounts()},
+			UDP:     CheckUptimeByType{Windows: newUptimeWindowCounts()},
+			ICMP:    CheckUptimeByType{Windows: newUptimeWindowCounts()},
 		}
-		uptime.Percent = (float64(uptime.TotalSuccess) / float64(uptime.TotalChecks)) * 100
+		u.Networks[network] = uptime
+	}
+	return uptime
+}
+
+func (u *CheckNetworkUptime) checkType(checkType CheckType) *CheckUptimeByType {
+	switch checkType {
+	case CheckHTTP:
+		return &u.HTTP
+	case CheckICMP:
+		return &u.ICMP
+	case CheckTCP:
+		return &u.TCP
+	default:
+		return &u.UDP
+	}
+}
 
-		// Store updated uptime metrics
-		data, err := json.Marshal(uptime)
+func (u CheckUptime) MarshalJSON() ([]byte, error) {
+	out := map[string]interface{}{
+		"percent":      u.Percent,
+		"totalSuccess": u.TotalSuccess,
+		"totalChecks":  u.TotalChecks,
+		"windows":      u.Windows,
+	}
+	for network, uptime := range u.Networks {
+		out[string(network)] = uptime
+	}
+	return json.Marshal(out)
+}
+
+func (u *CheckUptime) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	for key, val := range fields {
+		var err error
+		switch key {
+		case "percent":
+			err = json.Unmarshal(val, &u.Percent)
+		case "totalSuccess":
+			err = json.Unmarshal(val, &u.TotalSuccess)
+		case "totalChecks":
+			err = json.Unmarshal(val, &u.TotalChecks)
+		case "windows":
+			err = json.Unmarshal(val, &u.Windows)
+		default:
+			err = json.Unmarshal(val, u.network(Network(key)))
+		}
 		if err != nil {
 			return err
 		}
-		return txn.Set([]byte(key), data)
-	})
-}
-
-func (h *Host) setUptimes(db *badger.DB) error {
-	return db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-
-		uptime := &CheckUptime{}
-		key := fmt.Sprintf("uptime.%s", h.ID)
-		for it.Seek([]byte(key)); it.ValidForPrefix([]byte(key)); it.Next() {
-			fullKey := string(it.Item().Key())
-			keyParts := strings.Split(fullKey, ".")
-
-			var metrics CheckUptimeByType
-			it.Item().Value(func(val []byte) error {
-				return json.Unmarshal(val, &metrics)
-			})
-
-			uptime.TotalChecks += metrics.TotalChecks
-			uptime.TotalSuccess += metrics.TotalSuccess
-			uptime.Percent = (float64(uptime.TotalSuccess) / float64(uptime.TotalChecks) * 100)
-
-			switch keyParts[2] {
-			case string(NetworkInternal):
-				uptime.Internal.TotalChecks += metrics.TotalChecks
-				uptime.Internal.TotalSuccess += metrics.TotalSuccess
-				uptime.Internal.Percent = (float64(uptime.Internal.TotalSuccess) / float64(uptime.Internal.TotalChecks) * 100)
-
-				switch keyParts[3] {
-				case string(CheckHTTP):
-					uptime.Internal.HTTP = metrics
-				case string(CheckICMP):
-					uptime.Internal.ICMP = metrics
-				case string(CheckTCP):
-					uptime.Internal.TCP = metrics
-				case string(CheckUDP):
-					uptime.Internal.UDP = metrics
-				}
-			case string(NetworkPublic):
-				uptime.Public.TotalChecks += metrics.TotalChecks
-				uptime.Public.TotalSuccess += metrics.TotalSuccess
-				uptime.Public.Percent = (float64(uptime.Public.TotalSuccess) / float64(uptime.Public.TotalChecks) * 100)
-
-				switch keyParts[3] {
-				case string(CheckHTTP):
-					uptime.Public.HTTP = metrics
-				case string(CheckICMP):
-					uptime.Public.ICMP = metrics
-				case string(CheckTCP):
-					uptime.Public.TCP = metrics
-				case string(CheckUDP):
-					uptime.Public.UDP = metrics
-				}
-			}
-		}
-
-		h.CheckUptime = uptime
-		return nil
-	})
+	}
+	return nil
 }
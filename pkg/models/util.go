@@ -4,7 +4,8 @@ import (
 	"github.com/google/uuid"
 )
 
-const currentHostID = "current-host"
+// CurrentHostID is the id the current host is stored under
+const CurrentHostID = "current-host"
 
 func getID() string {
 	return uuid.New().String()
@@ -0,0 +1,242 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/config"
+	"github.com/brentahughes/service_tester/pkg/metrics"
+)
+
+const (
+	scopeName   = "github.com/brentahughes/service_tester"
+	pushTimeout = 10 * time.Second
+	// maxQueuedSpans is how many spans are kept for the next push, the oldest are dropped
+	// when the endpoint can't keep up
+	maxQueuedSpans = 10000
+)
+
+// Exporter pushes the metrics of the registry and the finished spans to an OTLP/HTTP
+// endpoint on an interval. A nil exporter is disabled and its spans do nothing.
+type Exporter struct {
+	endpoint string
+	interval time.Duration
+	headers  map[string]string
+	registry *metrics.Registry
+	client   *http.Client
+	resource resource
+	started  time.Time
+	done     chan struct{}
+	stopped  chan struct{}
+
+	mu      sync.Mutex
+	spans   []span
+	dropped int
+}
+
+// NewExporter returns the exporter of the configured endpoint, or nil when there is none
+func NewExporter(conf *config.Config, registry *metrics.Registry) *Exporter {
+	if conf.OTLP.Endpoint == "" {
+		return nil
+	}
+
+	hostname, _ := os.Hostname()
+	return &Exporter{
+		endpoint: strings.TrimSuffix(conf.OTLP.Endpoint, "/"),
+		interval: conf.OTLP.Interval,
+		headers:  conf.OTLP.Headers,
+		registry: registry,
+		client:   &http.Client{Timeout: pushTimeout},
+		resource: resource{Attributes: []keyValue{
+			attribute("service.name", "service_tester"),
+			attribute("host.name", hostname),
+		}},
+		started: time.Now(),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (e *Exporter) Start() {
+	log.Printf("pushing metrics and traces to %s every %s", e.endpoint, e.interval)
+	defer close(e.stopped)
+
+	tick := time.NewTicker(e.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			e.push()
+		case <-e.done:
+			e.push()
+			return
+		}
+	}
+}
+
+// Stop pushes what is left before returning
+func (e *Exporter) Stop() {
+	if e == nil {
+		return
+	}
+	log.Printf("Stopping otlp exporter")
+	close(e.done)
+	<-e.stopped
+}
+
+func (e *Exporter) push() {
+	if err := e.pushMetrics(); err != nil {
+		log.Printf("error pushing metrics to %s: %v", e.endpoint, err)
+	}
+	if err := e.pushTraces(); err != nil {
+		log.Printf("error pushing traces to %s: %v", e.endpoint, err)
+	}
+}
+
+func (e *Exporter) queueSpan(s span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.spans) >= maxQueuedSpans {
+		e.spans = e.spans[1:]
+		e.dropped++
+	}
+	e.spans = append(e.spans, s)
+}
+
+func (e *Exporter) pushTraces() error {
+	e.mu.Lock()
+	spans, dropped := e.spans, e.dropped
+	e.spans, e.dropped = nil, 0
+	e.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("dropped %d spans waiting to be pushed", dropped)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	return e.post("/v1/traces", tracesRequest{ResourceSpans: []resourceSpans{{
+		Resource:   e.resource,
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: scopeName}, Spans: spans}},
+	}}})
+}
+
+func (e *Exporter) pushMetrics() error {
+	now := unixNano(time.Now())
+	start := unixNano(e.started)
+
+	var encoded []metric
+	for _, f := range e.registry.Gather() {
+		if len(f.Metrics) == 0 {
+			continue
+		}
+
+		m := metric{Name: f.Name, Description: f.Help}
+		switch f.Type {
+		case metrics.Gauge:
+			m.Gauge = &gauge{DataPoints: numberDataPoints(f.Metrics, "", now)}
+		case metrics.Counter:
+			m.Sum = &sum{
+				DataPoints:             numberDataPoints(f.Metrics, start, now),
+				AggregationTemporality: temporalityCumulative,
+				IsMonotonic:            true,
+			}
+		case metrics.Histogram:
+			m.Histogram = &histogram{
+				DataPoints:             histogramDataPoints(f.Metrics, start, now),
+				AggregationTemporality: temporalityCumulative,
+			}
+		}
+		encoded = append(encoded, m)
+	}
+
+	return e.post("/v1/metrics", metricsRequest{ResourceMetrics: []resourceMetrics{{
+		Resource:     e.resource,
+		ScopeMetrics: []scopeMetrics{{Scope: scope{Name: scopeName}, Metrics: encoded}},
+	}}})
+}
+
+func numberDataPoints(ms []metrics.Metric, start, now string) []numberDataPoint {
+	points := make([]numberDataPoint, len(ms))
+	for i, m := range ms {
+		points[i] = numberDataPoint{
+			Attributes:        attributes(m.Labels),
+			StartTimeUnixNano: start,
+			TimeUnixNano:      now,
+			AsDouble:          m.Value,
+		}
+	}
+	return points
+}
+
+func histogramDataPoints(ms []metrics.Metric, start, now string) []histogramDataPoint {
+	var points []histogramDataPoint
+	for _, m := range ms {
+		if m.Histogram == nil {
+			continue
+		}
+
+		counts := make([]string, len(m.Histogram.Counts))
+		for i, c := range m.Histogram.Counts {
+			counts[i] = strconv.FormatUint(c, 10)
+		}
+		points = append(points, histogramDataPoint{
+			Attributes:        attributes(m.Labels),
+			StartTimeUnixNano: start,
+			TimeUnixNano:      now,
+			Count:             strconv.FormatUint(m.Histogram.Count, 10),
+			Sum:               m.Histogram.Sum,
+			BucketCounts:      counts,
+			ExplicitBounds:    m.Histogram.Bounds,
+		})
+	}
+	return points
+}
+
+func attributes(labels []metrics.Label) []keyValue {
+	attrs := make([]keyValue, len(labels))
+	for i, l := range labels {
+		attrs[i] = attribute(l.Name, l.Value)
+	}
+	return attrs
+}
+
+func (e *Exporter) post(path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("bad status response: %d", resp.StatusCode)
+	}
+	return nil
+}
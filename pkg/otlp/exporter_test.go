@@ -0,0 +1,183 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/config"
+	"github.com/brentahughes/service_tester/pkg/metrics"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// push is a request the receiver got and how it answered
+type push struct {
+	path   string
+	header http.Header
+	body   []byte
+	status int
+}
+
+// recordPushes serves the receiver and keeps every push sent to it
+func recordPushes(t *testing.T) (*httptest.Server, func() []push) {
+	var mu sync.Mutex
+	var pushes []push
+	receiver := &Receiver{Verbose: true}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		rec := httptest.NewRecorder()
+		receiver.ServeHTTP(rec, r)
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+
+		mu.Lock()
+		defer mu.Unlock()
+		pushes = append(pushes, push{path: r.URL.Path, header: r.Header, body: body, status: rec.Code})
+	}))
+	return srv, func() []push {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]push(nil), pushes...)
+	}
+}
+
+func attributeMap(attrs []keyValue) map[string]string {
+	m := make(map[string]string)
+	for _, a := range attrs {
+		m[a.Key] = a.Value.StringValue
+	}
+	return m
+}
+
+func TestExporterPush(t *testing.T) {
+	srv, pushes := recordPushes(t)
+	defer srv.Close()
+
+	conf := &config.Config{
+		Metrics: config.MetricsConfig{PeerLabel: "hostname", MaxPeers: 10, Buckets: []float64{0.25, 1}},
+		OTLP:    config.OTLPConfig{Endpoint: srv.URL + "/", Interval: time.Hour, Headers: map[string]string{"X-Token": "secret"}},
+	}
+	registry := metrics.NewRegistry(conf)
+	host := &models.Host{ID: "1", Hostname: "peer-1"}
+	registry.ObserveCheck(host, &models.Check{
+		Network:      models.NetworkPublic,
+		CheckType:    models.CheckTCP,
+		Status:       models.StatusSuccess,
+		ResponseTime: 500 * time.Millisecond,
+	})
+
+	e := NewExporter(conf, registry)
+	round := e.StartSpan("check host", nil)
+	round.SetAttribute("host", host.Hostname)
+	probe := e.StartSpan("probe tcp", round)
+	probe.SetClient()
+	probe.SetAttribute("host", host.Hostname)
+	probe.SetAttribute("network", string(models.NetworkPublic))
+	probe.SetAttribute("type", string(models.CheckTCP))
+	probe.SetError("connection refused")
+	probe.End()
+	round.End()
+
+	// Stop pushes what is left
+	go e.Start()
+	e.Stop()
+
+	got := pushes()
+	if len(got) != 2 {
+		t.Fatalf("expected a metrics and a traces push, got %d", len(got))
+	}
+	for _, p := range got {
+		if p.status != http.StatusOK {
+			t.Errorf("%s: expected the receiver to accept the push, got %d", p.path, p.status)
+		}
+		if p.header.Get("Content-Type") != "application/json" || p.header.Get("X-Token") != "secret" {
+			t.Errorf("%s: expected the json content type and the configured headers, got %v", p.path, p.header)
+		}
+	}
+
+	var mr metricsRequest
+	if got[0].path != "/v1/metrics" {
+		t.Fatalf("expected metrics to be pushed first, got %s", got[0].path)
+	}
+	if err := json.Unmarshal(got[0].body, &mr); err != nil {
+		t.Fatal(err)
+	}
+	if len(mr.ResourceMetrics) != 1 || attributeMap(mr.ResourceMetrics[0].Resource.Attributes)["service.name"] != "service_tester" {
+		t.Fatalf("expected the resource of the node, got %+v", mr.ResourceMetrics)
+	}
+	byName := make(map[string]metric)
+	for _, m := range mr.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		byName[m.Name] = m
+	}
+
+	labels := map[string]string{"peer": "peer-1", "network": "public", "type": "tcp"}
+	up := byName["service_tester_check_up"]
+	if up.Gauge == nil || len(up.Gauge.DataPoints) != 1 {
+		t.Fatalf("expected check_up to be a gauge with one point, got %+v", up)
+	}
+	if p := up.Gauge.DataPoints[0]; p.AsDouble != 1 || !reflect.DeepEqual(attributeMap(p.Attributes), labels) {
+		t.Errorf("unexpected check_up point %+v", p)
+	}
+
+	total := byName["service_tester_checks_total"]
+	if total.Sum == nil || !total.Sum.IsMonotonic || total.Sum.AggregationTemporality != temporalityCumulative {
+		t.Fatalf("expected checks_total to be a cumulative monotonic sum, got %+v", total)
+	}
+	if p := total.Sum.DataPoints[0]; p.AsDouble != 1 || p.StartTimeUnixNano == "" || !reflect.DeepEqual(attributeMap(p.Attributes), labels) {
+		t.Errorf("unexpected checks_total point %+v", p)
+	}
+
+	duration := byName["service_tester_check_duration_seconds"]
+	if duration.Histogram == nil || len(duration.Histogram.DataPoints) != 1 {
+		t.Fatalf("expected check_duration_seconds to be a histogram with one point, got %+v", duration)
+	}
+	hp := duration.Histogram.DataPoints[0]
+	if hp.Count != "1" || hp.Sum != 0.5 ||
+		!reflect.DeepEqual(hp.BucketCounts, []string{"0", "1", "0"}) ||
+		!reflect.DeepEqual(hp.ExplicitBounds, []float64{0.25, 1}) ||
+		!reflect.DeepEqual(attributeMap(hp.Attributes), labels) {
+		t.Errorf("unexpected check_duration_seconds point %+v", hp)
+	}
+
+	var tr tracesRequest
+	if got[1].path != "/v1/traces" {
+		t.Fatalf("expected traces to be pushed second, got %s", got[1].path)
+	}
+	if err := json.Unmarshal(got[1].body, &tr); err != nil {
+		t.Fatal(err)
+	}
+	spans := tr.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected two spans, got %+v", spans)
+	}
+
+	child, parent := spans[0], spans[1]
+	if parent.Name != "check host" || parent.ParentSpanID != "" || parent.Kind != spanKindInternal || parent.Status.Code != statusOK {
+		t.Errorf("unexpected round span %+v", parent)
+	}
+	if child.Name != "probe tcp" || child.Kind != spanKindClient || child.TraceID != parent.TraceID || child.ParentSpanID != parent.SpanID {
+		t.Errorf("expected the probe to be a client span in the trace of the round, got %+v", child)
+	}
+	if len(child.TraceID) != 32 || len(child.SpanID) != 16 {
+		t.Errorf("expected hex trace and span ids, got %s and %s", child.TraceID, child.SpanID)
+	}
+	expected := map[string]string{"host": "peer-1", "network": "public", "type": "TCP"}
+	if attrs := attributeMap(child.Attributes); !reflect.DeepEqual(attrs, expected) {
+		t.Errorf("expected the probe attributes %v, got %v", expected, attrs)
+	}
+	if child.Status.Code != statusError || child.Status.Message != "connection refused" {
+		t.Errorf("expected the probe to have failed, got %+v", child.Status)
+	}
+}
@@ -0,0 +1,114 @@
+package otlp
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Receiver is a stand-in for an OTLP collector that accepts the JSON pushes of the exporter
+// and logs what it received, to try out the exporter without running a collector
+type Receiver struct {
+	// Verbose logs every metric data point and span instead of a summary of each push
+	Verbose bool
+}
+
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/metrics":
+		var req metricsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rc.logMetrics(req)
+	case "/v1/traces":
+		var req tracesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rc.logTraces(req)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
+
+func (rc *Receiver) logMetrics(req metricsRequest) {
+	var count, points int
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				count++
+				switch {
+				case m.Gauge != nil:
+					points += len(m.Gauge.DataPoints)
+					rc.logNumbers(m.Name, m.Gauge.DataPoints)
+				case m.Sum != nil:
+					points += len(m.Sum.DataPoints)
+					rc.logNumbers(m.Name, m.Sum.DataPoints)
+				case m.Histogram != nil:
+					points += len(m.Histogram.DataPoints)
+					if rc.Verbose {
+						for _, p := range m.Histogram.DataPoints {
+							log.Printf("  %s%s count=%s sum=%v", m.Name, formatAttributes(p.Attributes), p.Count, p.Sum)
+						}
+					}
+				}
+			}
+		}
+	}
+	log.Printf("received %d metrics with %d data points", count, points)
+}
+
+func (rc *Receiver) logNumbers(name string, points []numberDataPoint) {
+	if !rc.Verbose {
+		return
+	}
+	for _, p := range points {
+		log.Printf("  %s%s %v", name, formatAttributes(p.Attributes), p.AsDouble)
+	}
+}
+
+func (rc *Receiver) logTraces(req tracesRequest) {
+	var count, failed int
+	traces := make(map[string]bool)
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				count++
+				traces[s.TraceID] = true
+				if s.Status.Code == statusError {
+					failed++
+				}
+				if rc.Verbose {
+					log.Printf("  %s/%s %s%s %s", s.TraceID, s.SpanID, s.Name, formatAttributes(s.Attributes), s.Status.Message)
+				}
+			}
+		}
+	}
+	log.Printf("received %d spans of %d traces, %d failed", count, len(traces), failed)
+}
+
+func formatAttributes(attrs []keyValue) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	s := "{"
+	for i, a := range attrs {
+		if i > 0 {
+			s += ","
+		}
+		s += a.Key + "=" + a.Value.StringValue
+	}
+	return s + "}"
+}
@@ -0,0 +1,109 @@
+package otlp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Span is a timed operation of a trace, such as a round of checks or a single probe. The
+// methods of a nil span do nothing so callers don't need to check if tracing is enabled.
+type Span struct {
+	exporter *Exporter
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	kind     int
+	start    time.Time
+
+	mu         sync.Mutex
+	attributes []keyValue
+	err        string
+}
+
+// StartSpan starts a span now, as a child of parent or the root of a new trace when parent is nil
+func (e *Exporter) StartSpan(name string, parent *Span) *Span {
+	return e.StartSpanAt(name, parent, time.Now())
+}
+
+// StartSpanAt starts a span at start, for operations that are only known after they finished
+func (e *Exporter) StartSpanAt(name string, parent *Span, start time.Time) *Span {
+	if e == nil {
+		return nil
+	}
+
+	s := &Span{
+		exporter: e,
+		traceID:  randomID(16),
+		spanID:   randomID(8),
+		name:     name,
+		kind:     spanKindInternal,
+		start:    start,
+	}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	}
+	return s
+}
+
+// SetClient marks the span as a request to a peer
+func (s *Span) SetClient() {
+	if s == nil {
+		return
+	}
+	s.kind = spanKindClient
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, attribute(key, value))
+}
+
+// SetError marks the span as failed with the message
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = message
+}
+
+// End finishes the span now and queues it for the next push
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	encoded := span{
+		TraceID:           s.traceID,
+		SpanID:            s.spanID,
+		ParentSpanID:      s.parentID,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: unixNano(s.start),
+		EndTimeUnixNano:   unixNano(time.Now()),
+		Attributes:        s.attributes,
+		Status:            spanStatus{Code: statusOK},
+	}
+	if s.err != "" {
+		encoded.Status = spanStatus{Code: statusError, Message: s.err}
+	}
+	s.mu.Unlock()
+
+	s.exporter.queueSpan(encoded)
+}
+
+func randomID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,174 @@
+package rollup
+
+import (
+	"log"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/config"
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+const (
+	// rollupDelay gives checks running at the end of a window time to be stored before it is rolled up
+	rollupDelay = 15 * time.Second
+
+	// backfill is how far back minute rollups start on the first run, raw checks are not kept longer
+	backfill = time.Hour
+)
+
+// Downsampler rolls raw checks up into minute windows, minutes into hours and hours into days
+// so history is kept far longer than the raw checks
+type Downsampler struct {
+	db        database.Store
+	retention config.RollupRetention
+	stop      chan struct{}
+}
+
+func NewDownsampler(db database.Store, conf *config.Config) *Downsampler {
+	return &Downsampler{
+		db:        db,
+		retention: conf.Retention,
+		stop:      make(chan struct{}),
+	}
+}
+
+func (d *Downsampler) Start() {
+	d.run()
+
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			d.run()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+func (d *Downsampler) Stop() {
+	log.Printf("Shutting down downsampler")
+	close(d.stop)
+}
+
+func (d *Downsampler) run() {
+	now := time.Now().UTC().Add(-rollupDelay)
+
+	// Each resolution is built from the one before it so they have to run in order
+	for _, resolution := range models.Resolutions {
+		if err := d.rollup(resolution, now); err != nil {
+			log.Printf("error rolling up %s checks: %v", resolution, err)
+			return
+		}
+	}
+}
+
+// rollup builds the windows of the resolution that completed since it last ran
+func (d *Downsampler) rollup(resolution models.Resolution, now time.Time) error {
+	end := now.Truncate(resolution.Duration())
+	start, err := d.db.GetRollupWatermark(resolution)
+	if err != nil {
+		return err
+	}
+	if start.IsZero() {
+		start = end.Add(-resolution.Duration())
+		if resolution == models.ResolutionMinute {
+			start = end.Add(-backfill)
+		}
+	}
+	if !start.Before(end) {
+		return nil
+	}
+
+	var rollups []models.Rollup
+	if resolution == models.ResolutionMinute {
+		checks, err := d.db.GetChecksBetween(start, end)
+		if err != nil {
+			return err
+		}
+		rollups = fromChecks(checks, resolution)
+	} else {
+		finer, err := d.db.GetRollups(models.RollupFilter{
+			Resolution: finerResolution(resolution),
+			Start:      start,
+			End:        end,
+		})
+		if err != nil {
+			return err
+		}
+		rollups = merge(finer, resolution)
+	}
+
+	if len(rollups) > 0 {
+		if err := d.db.SaveRollups(rollups, d.retentionFor(resolution)); err != nil {
+			return err
+		}
+	}
+
+	return d.db.SetRollupWatermark(resolution, end)
+}
+
+func (d *Downsampler) retentionFor(resolution models.Resolution) time.Duration {
+	switch resolution {
+	case models.ResolutionMinute:
+		return d.retention.Minute
+	case models.ResolutionHour:
+		return d.retention.Hour
+	default:
+		return d.retention.Day
+	}
+}
+
+func finerResolution(resolution models.Resolution) models.Resolution {
+	for i, r := range models.Resolutions {
+		if r == resolution && i > 0 {
+			return models.Resolutions[i-1]
+		}
+	}
+	return resolution
+}
+
+type window struct {
+	hostID    string
+	network   models.Network
+	checkType models.CheckType
+	start     time.Time
+}
+
+func fromChecks(checks []models.Check, resolution models.Resolution) []models.Rollup {
+	windows := make(map[window]*models.Rollup)
+	for _, check := range checks {
+		key := window{check.HostID, check.Network, check.CheckType, check.CheckedAt.UTC().Truncate(resolution.Duration())}
+		r, ok := windows[key]
+		if !ok {
+			r = models.NewRollup(check.HostID, check.Network, check.CheckType, resolution, check.CheckedAt)
+			windows[key] = r
+		}
+		r.Add(check)
+	}
+	return flatten(windows)
+}
+
+func merge(finer []models.Rollup, resolution models.Resolution) []models.Rollup {
+	windows := make(map[window]*models.Rollup)
+	for _, f := range finer {
+		key := window{f.HostID, f.Network, f.CheckType, f.Start.Truncate(resolution.Duration())}
+		r, ok := windows[key]
+		if !ok {
+			r = models.NewRollup(f.HostID, f.Network, f.CheckType, resolution, f.Start)
+			windows[key] = r
+		}
+		r.Merge(f)
+	}
+	return flatten(windows)
+}
+
+func flatten(windows map[window]*models.Rollup) []models.Rollup {
+	rollups := make([]models.Rollup, 0, len(windows))
+	for _, r := range windows {
+		rollups = append(rollups, *r)
+	}
+	return rollups
+}
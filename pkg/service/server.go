@@ -2,6 +2,11 @@ package service
 
 import (
 	"encoding/json"
+	"log"
+	"net"
+
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/models"
 )
 
 type Service struct {
@@ -17,15 +22,20 @@ type server interface {
 type serviceResponse struct {
 	Status        string `json:"status"`
 	ReceivedInput string `json:"receivedInput,omitempty"`
+	ObservedAddr  string `json:"observedAddr,omitempty"`
+	Hostname      string `json:"hostname,omitempty"`
+	InstanceID    string `json:"instanceId,omitempty"`
 	Error         string `json:"error,omitempty"`
 }
 
-func NewService(port int) *Service {
+func NewService(db database.Store, port int) *Service {
 	return &Service{
 		udpServer: &udpServer{
+			db:   db,
 			port: port,
 		},
 		tcpServer: &tcpServer{
+			db:   db,
 			port: port,
 		},
 	}
@@ -36,12 +46,35 @@ func (s *Service) Start() {
 	go s.udpServer.run()
 }
 
-func marshalResponse(status, input, err string) []byte {
-	data, _ := json.Marshal(serviceResponse{
-		Status:        status,
-		ReceivedInput: input,
-		Error:         err,
-	})
-
+func marshalResponse(resp serviceResponse) []byte {
+	data, _ := json.Marshal(resp)
 	return append(data, []byte("\n")...)
 }
+
+// recordInbound stores the probe against the peer that sent it. The peer is looked up
+// by the hostname it sent if there is one, otherwise by the source address.
+// Probes from hosts that have not been discovered yet are not recorded.
+func recordInbound(db database.Store, addr net.Addr, hostname string, checkType models.CheckType, bytes int) {
+	var host *models.Host
+	var err error
+	if hostname != "" {
+		host, err = db.GetHostByHostname(hostname)
+	}
+	if host == nil {
+		ip, _, splitErr := net.SplitHostPort(addr.String())
+		if splitErr != nil {
+			return
+		}
+		host, err = db.GetHostByIP(ip)
+	}
+	if err != nil {
+		if err != database.ErrNotFound {
+			log.Printf("error looking up inbound peer %s: %v", addr, err)
+		}
+		return
+	}
+
+	if err := db.RecordInbound(host, checkType, bytes); err != nil {
+		log.Printf("error recording inbound %s from %s: %v", checkType, host.Hostname, err)
+	}
+}
@@ -6,9 +6,13 @@ import (
 	"log"
 	"net"
 	"strings"
+
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/models"
 )
 
 type tcpServer struct {
+	db     database.Store
 	port   int
 	server net.Listener
 }
@@ -68,13 +72,31 @@ func (s *tcpServer) handleConnection(conn net.Conn) {
 			}
 
 			log.Printf("error reading tcp input: %v", err)
-			rw.Write(marshalResponse("error", "", "failed to read input: "+err.Error()))
+			rw.Write(s.response("error", "", conn.RemoteAddr(), "failed to read input: "+err.Error()))
 			rw.Flush()
 			return
 		}
+		recordInbound(s.db, conn.RemoteAddr(), strings.TrimSpace(req), models.CheckTCP, len(req))
 		req = strings.TrimSuffix(req, "\n")
 
-		rw.Write(marshalResponse("success", req, ""))
+		rw.Write(s.response("success", req, conn.RemoteAddr(), ""))
 		rw.Flush()
 	}
 }
+
+// response includes the identity of this node so the checker can verify it reached the host it expected
+func (s *tcpServer) response(status, input string, observed net.Addr, err string) []byte {
+	resp := serviceResponse{
+		Status:        status,
+		ReceivedInput: input,
+		ObservedAddr:  observed.String(),
+		Error:         err,
+	}
+
+	if current, err := s.db.GetCurrentHost(); err == nil {
+		resp.Hostname = current.Hostname
+		resp.InstanceID = current.InstanceID
+	}
+
+	return marshalResponse(resp)
+}
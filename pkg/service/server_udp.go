@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"log"
 	"net"
+
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/models"
 )
 
 type udpServer struct {
+	db     database.Store
 	port   int
 	server *net.UDPConn
 }
@@ -52,8 +56,13 @@ func (s *udpServer) handleConnections() {
 }
 
 func (s *udpServer) handleConnection(addr *net.UDPAddr, cmd []byte) {
+	recordInbound(s.db, addr, "", models.CheckUDP, len(cmd))
 	cmd = bytes.TrimSuffix(cmd, []byte("\n"))
-	if string(cmd) == "ping" {
+	switch string(cmd) {
+	case "ping":
 		s.server.WriteToUDP([]byte("pong\n"), addr)
+	case "addr":
+		// Reply with the address the request came from so the sender can detect NAT
+		s.server.WriteToUDP([]byte("addr "+addr.String()+"\n"), addr)
 	}
 }
@@ -0,0 +1,20 @@
+package servicecheck
+
+import (
+	"syscall"
+)
+
+// bindToInterface binds every socket of the source to the interface with SO_BINDTODEVICE
+func bindToInterface(src *probeSource) error {
+	src.control = func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, src.iface)
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build !linux
+// +build !linux
+
+package servicecheck
+
+import (
+	"fmt"
+	"net"
+)
+
+// bindToInterface falls back to using the first ipv4 address of the interface as the
+// source since SO_BINDTODEVICE is only available on linux
+func bindToInterface(src *probeSource) error {
+	ip, err := interfaceIPv4(src.iface)
+	if err != nil {
+		return err
+	}
+
+	src.ip = ip
+	return nil
+}
+
+// interfaceIPv4 returns the first ipv4 address on the interface
+func interfaceIPv4(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("no ipv4 address on interface %s", name)
+}
@@ -1,60 +1,126 @@
 package servicecheck
 
 import (
+	"fmt"
 	"log"
 	"net"
 	"net/http"
-	"strings"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/brentahughes/service_tester/pkg/config"
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/incident"
+	"github.com/brentahughes/service_tester/pkg/metrics"
 	"github.com/brentahughes/service_tester/pkg/models"
-	"github.com/dgraph-io/badger"
-	"github.com/digineo/go-ping"
+	"github.com/brentahughes/service_tester/pkg/otlp"
+	"github.com/brentahughes/service_tester/pkg/stream"
 	"github.com/panjf2000/ants"
 )
 
 type Checker struct {
-	db         *badger.DB
-	cfg        *config.Config
-	pool       *ants.PoolWithFunc
-	pinger     pinger
-	httpClient *http.Client
+	db            database.Store
+	cfg           *config.Config
+	pool          *ants.PoolWithFunc
+	httpClient    *http.Client
+	defaultSource *probeSource
+	sources       map[models.Network]*probeSource
+	reflexiveConn *net.UDPConn
+	hostname      string
+	selector      models.Selector
+	incidents     *incident.Tracker
+	events        *database.EventLog
+	metrics       *metrics.Registry
+	tracer        *otlp.Exporter
+	hub           *stream.Hub
+
+	// rounds and lastRound are the number of finished rounds and the nanoseconds the last one
+	// took, busy is the number of hosts being checked
+	rounds    uint64
+	lastRound int64
+	busy      int64
+
+	// discovered are the ids of the hosts found by the last discovery and missing the
+	// ids of the hosts that have not been found since they disappeared from it
+	discovered map[string]bool
+	missing    map[string]bool
 }
 
 func NewChecker(
-	db *badger.DB,
+	db database.Store,
 	conf *config.Config,
+	registry *metrics.Registry,
+	tracer *otlp.Exporter,
+	hub *stream.Hub,
+	events *database.EventLog,
 ) (*Checker, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
 	c := &Checker{
-		db:  db,
-		cfg: conf,
+		db:       db,
+		cfg:      conf,
+		hostname: hostname,
+		events:   events,
+		metrics:  registry,
+		tracer:   tracer,
+		hub:      hub,
+		missing:  make(map[string]bool),
 		httpClient: &http.Client{
 			Timeout: checkTimeout,
 		},
 	}
 
+	c.selector, err = models.ParseSelector(conf.PeerSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	c.incidents, err = incident.NewTracker(db, conf, c.events)
+	if err != nil {
+		return nil, err
+	}
+
 	pool, err := ants.NewPoolWithFunc(conf.ParallelChecks, c.checkHost)
 	if err != nil {
 		return nil, err
 	}
 	c.pool = pool
+	c.registerMetrics()
 
-	var p pinger
-	p, err = ping.New("0.0.0.0", "")
+	p, err := newPinger("0.0.0.0")
 	if err != nil {
-		if opErr, ok := err.(*net.OpError); ok && strings.Contains(opErr.Err.Error(), "operation not permitted") {
-			p = &pingNoOp{}
-		} else {
-			return nil, err
+		return nil, err
+	}
+	c.defaultSource = &probeSource{
+		httpClient: c.httpClient,
+		pinger:     p,
+	}
+
+	c.sources = make(map[models.Network]*probeSource)
+	for network, value := range conf.Sources {
+		src, err := newProbeSource(value)
+		if err != nil {
+			return nil, fmt.Errorf("error setting up source for network %s: %v", network, err)
 		}
+		c.sources[models.Network(network)] = src
+	}
+
+	c.reflexiveConn, err = net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
 	}
-	c.pinger = p
 
 	return c, nil
 }
 
 func (c *Checker) Start() {
+	go c.readReflexive()
 	c.runCheck()
 
 	tick := time.NewTicker(c.cfg.CheckInterval)
@@ -65,22 +131,83 @@ func (c *Checker) Start() {
 
 func (c *Checker) Stop() {
 	log.Printf("Shutting down checker")
-	c.httpClient.CloseIdleConnections()
-	c.pinger.Close()
+	c.defaultSource.close()
+	for _, src := range c.sources {
+		src.close()
+	}
+	c.reflexiveConn.Close()
 }
 
 func (c *Checker) runCheck() {
 	c.discoverNewHosts()
 
-	hosts, err := models.GetHosts(c.db)
+	hosts, err := c.db.GetHosts()
 	if err != nil {
 		log.Printf("error getting recent hosts: %v", err)
 		return
 	}
+	known := make(map[string]bool)
+	for _, host := range hosts {
+		known[host.ID] = true
+	}
 
+	// Only probe the peers matching the selector, every peer is still discovered
+	hosts = c.selector.FilterHosts(hosts)
+	start := time.Now()
+	span := c.tracer.StartSpan("check round", nil)
+	span.SetAttribute("hosts", strconv.Itoa(len(hosts)))
+	round := &sync.WaitGroup{}
+	checked := make(map[string]bool)
+	networks := make(map[string]map[models.Network]bool)
 	for _, host := range hosts {
-		c.pool.Invoke(host)
+		// Hosts whose addresses all moved to other nodes are kept for their history only
+		addrs := host.NetworkAddresses()
+		if len(addrs) == 0 {
+			continue
+		}
+
+		checked[host.ID] = true
+		networks[host.ID] = make(map[models.Network]bool)
+		for network := range addrs {
+			networks[host.ID][network] = true
+		}
+		round.Add(1)
+		if err := c.pool.Invoke(hostCheck{host: host, round: round, span: span}); err != nil {
+			log.Printf("error checking host (%s): %v", host.Hostname, err)
+			round.Done()
+		}
 	}
+	c.hub.Prune(checked)
+	c.incidents.CloseUnchecked(known, networks)
+
+	// The next round starts on the interval even if this one is still running, so it is timed in the background
+	go func() {
+		round.Wait()
+		atomic.StoreInt64(&c.lastRound, int64(time.Since(start)))
+		atomic.AddUint64(&c.rounds, 1)
+		span.End()
+	}()
+
+	c.probeReflexive(hosts)
+}
+
+// registerMetrics adds the metrics of the worker pool and the rounds of checks
+func (c *Checker) registerMetrics() {
+	c.metrics.GaugeFunc("pool_busy", "Hosts being checked by the worker pool", func() float64 {
+		return float64(atomic.LoadInt64(&c.busy))
+	})
+	c.metrics.GaugeFunc("pool_capacity", "Hosts the worker pool checks in parallel", func() float64 {
+		return float64(c.pool.Cap())
+	})
+	c.metrics.GaugeFunc("pool_utilization_ratio", "Share of the worker pool that is busy", func() float64 {
+		return float64(atomic.LoadInt64(&c.busy)) / float64(c.pool.Cap())
+	})
+	c.metrics.GaugeFunc("round_duration_seconds", "Time the last round took to check every host", func() float64 {
+		return time.Duration(atomic.LoadInt64(&c.lastRound)).Seconds()
+	})
+	c.metrics.CounterFunc("rounds_total", "Rounds of checks finished", func() float64 {
+		return float64(atomic.LoadUint64(&c.rounds))
+	})
 }
 
 func (c *Checker) discoverNewHosts() {
@@ -95,34 +222,80 @@ func (c *Checker) discoverNewHosts() {
 		}
 	}
 
-	currentHost, err := models.GetCurrentHost(c.db)
+	currentHost, err := c.db.GetCurrentHost()
 	if err != nil {
 		log.Printf("error getting current host %v", err)
 		return
 	}
 
+	discovered := make(map[string]bool)
 	for _, ip := range ips {
-		if currentHost.PublicIP == ip || currentHost.InternalIP == ip {
+		if currentHost.HasIP(ip) {
 			continue
 		}
 
-		host, err := models.GetHostByIP(c.db, ip)
+		host, err := c.db.GetHostByIP(ip)
 		if err != nil {
-			if err != badger.ErrKeyNotFound {
+			if err != database.ErrNotFound {
 				log.Printf("error looking up host by ip (%s) %v", ip, err)
 				continue
 			}
 
 			// Call health endpoint and save host information
-			c.newHost(ip)
+			if host = c.newHost(ip); host != nil {
+				discovered[host.ID] = true
+			}
 		} else {
+			discovered[host.ID] = true
+
 			// Update the last seen
-			if err := host.Save(c.db); err != nil {
+			if err := c.db.SaveHost(host); err != nil {
 				log.Printf("error updating host (%s): %v", host.Hostname, err)
 				continue
 			}
 		}
 	}
+
+	c.compareDiscovered(discovered)
+}
+
+// compareDiscovered records the hosts that disappeared from discovery since the last time
+// and the hosts that are found again after they disappeared
+func (c *Checker) compareDiscovered(discovered map[string]bool) {
+	for id := range discovered {
+		if !c.missing[id] {
+			continue
+		}
+		delete(c.missing, id)
+		c.incidents.Resume(id)
+		if host, err := c.db.GetHostByID(id); err == nil {
+			c.events.Record(models.NewEvent(
+				models.EventHostReappeared,
+				host,
+				fmt.Sprintf("%s is found by discovery again", host.Hostname),
+			))
+		}
+	}
+
+	for id := range c.discovered {
+		if discovered[id] {
+			continue
+		}
+		c.missing[id] = true
+
+		host, err := c.db.GetHostByID(id)
+		if err != nil {
+			log.Printf("error getting host (%s): %v", id, err)
+			continue
+		}
+		c.events.Record(models.NewEvent(
+			models.EventHostDisappeared,
+			host,
+			fmt.Sprintf("%s is no longer found by discovery", host.Hostname),
+		))
+		c.incidents.CloseHost(host, "the host is no longer found by discovery")
+	}
+	c.discovered = discovered
 }
 
 func (c *Checker) discoverHosts() ([]string, error) {
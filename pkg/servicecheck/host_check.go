@@ -2,41 +2,53 @@ package servicecheck
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
-	"regexp"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	apiv1 "github.com/brentahughes/service_tester/pkg/api/v1"
+	"github.com/brentahughes/service_tester/pkg/client"
+	"github.com/brentahughes/service_tester/pkg/database"
 	"github.com/brentahughes/service_tester/pkg/models"
-	"github.com/dgraph-io/badger"
+	"github.com/brentahughes/service_tester/pkg/otlp"
 )
 
 const checkTimeout = 3 * time.Second
 
 type healthResponse struct {
-	models.Host
+	apiv1.HealthResponse
 
 	statusCode   int
 	responseBody string
 	responseTime time.Duration
 	errorMessage error
+	localAddr    net.Addr
 }
 
 type serviceResponse struct {
 	Status        string `json:"status"`
 	ReceivedInput string `json:"receivedInput,omitempty"`
+	ObservedAddr  string `json:"observedAddr,omitempty"`
+	Hostname      string `json:"hostname,omitempty"`
+	InstanceID    string `json:"instanceId,omitempty"`
 	Error         string `json:"error,omitempty"`
 }
 
-func (c *Checker) newHost(ip string) {
-	resp := c.checkHealth(ip)
+// newHost saves the host answering the health check at ip and returns it, nil on errors
+func (c *Checker) newHost(ip string) *models.Host {
+	resp := c.checkHealth(c.httpClient, ip)
 	if resp.errorMessage != nil {
 		log.Printf("error getting health of new host: %s", resp.errorMessage)
-		return
+		return nil
 	}
 
 	var discoveredIP string
@@ -44,45 +56,111 @@ func (c *Checker) newHost(ip string) {
 		discoveredIP = ip
 	}
 
-	host := resp.Host
+	host := *resp.Host
 	host.DiscoveredIP = discoveredIP
 
-	if err := host.Save(c.db); err != nil {
+	// The peer reports its own local id, a new one is assigned when saving
+	host.ID = ""
+
+	if err := c.db.SaveHost(&host); err != nil {
 		log.Printf("error saving host (%s): %v", host.Hostname, err)
-		return
+		return nil
 	}
+
+	c.events.Record(models.NewEvent(
+		models.EventHostDiscovered,
+		&host,
+		fmt.Sprintf("discovered %s at %s", host.Hostname, ip),
+	).WithDetail("ip", ip))
+	return &host
+}
+
+// hostCheck is a host to check in a round of checks
+type hostCheck struct {
+	host  models.Host
+	round *sync.WaitGroup
+	span  *otlp.Span
 }
 
 func (c *Checker) checkHost(input interface{}) {
-	host := input.(models.Host)
+	hc := input.(hostCheck)
+	atomic.AddInt64(&c.busy, 1)
+	defer func() {
+		atomic.AddInt64(&c.busy, -1)
+		hc.round.Done()
+	}()
+	host := hc.host
+
+	span := c.tracer.StartSpan("check host", hc.span)
+	span.SetAttribute("host", host.Hostname)
+	span.SetAttribute("host.id", host.ID)
+	defer span.End()
+
+	var reported *models.Host
+	var reachable models.Network
+	addrs := host.NetworkAddresses()
+	for _, network := range host.Networks() {
+		ip := addrs[network]
+		if r := c.checkNetworkHTTP(host, network, ip, span); r != nil {
+			reported = r
+			if reachable == "" {
+				reachable = network
+			}
+		}
+		c.checkNetworkICMP(host, network, ip, span)
+		c.checkNetworkTCP(host, network, ip, span)
+		c.checkNetworkUDP(host, network, ip, span)
+	}
 
-	if host.PublicIP != "" {
-		c.checkNetworkHTTP(host, models.NetworkPublic)
-		c.checkNetworkICMP(host, models.NetworkPublic)
-		c.checkNetworkTCP(host, models.NetworkPublic)
-		c.checkNetworkUDP(host, models.NetworkPublic)
+	// Update the host once with what it reported, not once for each network
+	if reported == nil {
+		return
 	}
+	c.updatePeer(host, reported)
 
-	if host.InternalIP != "" {
-		c.checkNetworkHTTP(host, models.NetworkInternal)
-		c.checkNetworkICMP(host, models.NetworkInternal)
-		c.checkNetworkTCP(host, models.NetworkInternal)
-		c.checkNetworkUDP(host, models.NetworkInternal)
+	// Get list of hosts known by the current checked host and add them if not known, through
+	// the first network its health check succeeded on
+	if err := c.checkForNewHosts(c.source(reachable).httpClient, addrs[reachable]); err != nil {
+		log.Printf("error getting new hosts from %s: %v", host.Hostname, err)
+		return
 	}
+}
 
-	// Get list of hosts known by the current checked host and add them if not known
-	if err := c.checkForNewHosts(host.PublicIP); err != nil {
-		log.Printf("error getting new hosts from %s", host)
+// saveCheck stores the check, updates the incidents and metrics of the host with it, sends
+// it to the live stream and traces it as a probe of the host's span
+func (c *Checker) saveCheck(host models.Host, check *models.Check, span *otlp.Span) {
+	c.traceCheck(host, check, span)
+	if err := c.db.AddCheck(&host, check); err != nil {
+		log.Printf("error adding check: %v", err)
 		return
 	}
+	c.incidents.Observe(&host, check)
+	c.metrics.ObserveCheck(&host, check)
+	c.hub.PublishCheck(&host, check)
 }
 
-func (c *Checker) checkNetworkICMP(host models.Host, network models.Network) {
-	ip := host.PublicIP
-	if network == models.NetworkInternal {
-		ip = host.InternalIP
+// traceCheck records the check as a span that ended now and took its response time
+func (c *Checker) traceCheck(host models.Host, check *models.Check, parent *otlp.Span) {
+	probe := c.tracer.StartSpanAt("probe "+strings.ToLower(string(check.CheckType)), parent, time.Now().Add(-check.ResponseTime))
+	if probe == nil {
+		return
+	}
+
+	probe.SetClient()
+	probe.SetAttribute("host", host.Hostname)
+	probe.SetAttribute("network", string(check.Network))
+	probe.SetAttribute("type", string(check.CheckType))
+	probe.SetAttribute("status", string(check.Status))
+	if check.SourceIP != "" {
+		probe.SetAttribute("source.ip", check.SourceIP)
 	}
+	if check.Failed() {
+		probe.SetError(check.CheckErrorMessage)
+	}
+	probe.End()
+}
 
+func (c *Checker) checkNetworkICMP(host models.Host, network models.Network, ip string, span *otlp.Span) {
 	parsedIP := &net.IPAddr{
 		IP: net.ParseIP(ip),
 	}
@@ -95,7 +173,10 @@ func (c *Checker) checkNetworkICMP(host models.Host, network models.Network) {
 		ResponseTime: checkTimeout,
 	}
 
-	duration, err := c.pinger.Ping(parsedIP, checkTimeout)
+	src := c.source(network)
+	src.setSource(check, src.routeSource(ip))
+
+	duration, err := src.pinger.Ping(parsedIP, checkTimeout)
 	if err != nil {
 		if err == errPingDisabled {
 			check.Status = models.StatusUnknown
@@ -108,18 +189,13 @@ func (c *Checker) checkNetworkICMP(host models.Host, network models.Network) {
 		check.ResponseTime = duration
 	}
 
-	if err := host.AddCheck(c.db, check); err != nil {
-		log.Printf("error adding check: %v", err)
-		return
-	}
+	c.saveCheck(host, check, span)
 }
 
-func (c *Checker) checkNetworkHTTP(host models.Host, network models.Network) {
-	ip := host.PublicIP
-	if network == models.NetworkInternal {
-		ip = host.InternalIP
-	}
-
+// checkNetworkHTTP checks the health endpoint and returns the host the peer reported
+// when it answered as the expected host
+func (c *Checker) checkNetworkHTTP(host models.Host, network models.Network, ip string, span *otlp.Span) *models.Host {
+	var reported *models.Host
 	check := &models.Check{
 		CheckType:  models.CheckHTTP,
 		Status:     models.StatusSuccess,
@@ -127,28 +203,31 @@ func (c *Checker) checkNetworkHTTP(host models.Host, network models.Network) {
 		Network:    network,
 	}
 
-	resp := c.checkHealth(ip)
+	src := c.source(network)
+	resp := c.checkHealth(src.httpClient, ip)
+	src.setSource(check, resp.localAddr)
 	if resp.errorMessage != nil {
 		check.CheckErrorMessage = resp.errorMessage.Error()
 		check.Status = models.StatusError
 	} else {
 		check.ResponseBody = resp.responseBody
+		c.saveReflexive(host, network, models.CheckHTTP, nil, resp.ObservedAddr)
+
+		if err := c.verifyIdentity(host, ip, resp.Hostname, resp.InstanceID); err != nil {
+			check.CheckErrorMessage = err.Error()
+			check.Status = models.StatusIdentityMismatch
+		} else {
+			reported = resp.Host
+		}
 	}
 	check.StatusCode = resp.statusCode
 	check.ResponseTime = resp.responseTime
 
-	if err := host.AddCheck(c.db, check); err != nil {
-		log.Printf("error adding check: %v", err)
-		return
-	}
+	c.saveCheck(host, check, span)
+	return reported
 }
 
-func (c *Checker) checkNetworkTCP(host models.Host, network models.Network) {
-	ip := host.PublicIP
-	if network == models.NetworkInternal {
-		ip = host.InternalIP
-	}
-
+func (c *Checker) checkNetworkTCP(host models.Host, network models.Network, ip string, span *otlp.Span) {
 	check := &models.Check{
 		CheckType:  models.CheckTCP,
 		Status:     models.StatusSuccess,
@@ -156,15 +235,19 @@ func (c *Checker) checkNetworkTCP(host models.Host, network models.Network) {
 		Network:    network,
 	}
 
+	src := c.source(network)
 	start := time.Now()
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", ip, c.cfg.ServicePort), checkTimeout)
+	conn, err := src.dialer("tcp").Dial("tcp", net.JoinHostPort(ip, strconv.Itoa(c.cfg.ServicePort)))
 	if err != nil {
 		check.CheckErrorMessage = err.Error()
 		check.Status = models.StatusError
 		check.StatusCode = 500
 	} else {
 		defer conn.Close()
-		fmt.Fprintln(conn, host.Hostname)
+		src.setSource(check, conn.LocalAddr())
+
+		// Send our own hostname so the remote service can attribute the probe to us
+		fmt.Fprintln(conn, c.hostname)
 		message, err := bufio.NewReader(conn).ReadBytes('\n')
 
 		if err != nil {
@@ -181,27 +264,23 @@ func (c *Checker) checkNetworkTCP(host models.Host, network models.Network) {
 			}
 
 			check.ResponseBody = string(message)
+			c.saveReflexive(host, network, models.CheckTCP, conn.LocalAddr(), resp.ObservedAddr)
 			if resp.Status == "error" {
 				check.Status = models.StatusError
 				check.StatusCode = 500
 				check.CheckErrorMessage = resp.Error
+			} else if err := c.verifyIdentity(host, ip, resp.Hostname, resp.InstanceID); err != nil {
+				check.Status = models.StatusIdentityMismatch
+				check.CheckErrorMessage = err.Error()
 			}
 		}
 	}
 
 	check.ResponseTime = time.Since(start)
-	if err := host.AddCheck(c.db, check); err != nil {
-		log.Printf("error adding check: %v", err)
-		return
-	}
+	c.saveCheck(host, check, span)
 }
 
-func (c *Checker) checkNetworkUDP(host models.Host, network models.Network) {
-	ip := host.PublicIP
-	if network == models.NetworkInternal {
-		ip = host.InternalIP
-	}
-
+func (c *Checker) checkNetworkUDP(host models.Host, network models.Network, ip string, span *otlp.Span) {
 	check := &models.Check{
 		CheckType:  models.CheckUDP,
 		Status:     models.StatusSuccess,
@@ -215,14 +294,16 @@ func (c *Checker) checkNetworkUDP(host models.Host, network models.Network) {
 		return
 	}
 
+	src := c.source(network)
 	start := time.Now()
-	conn, err := net.DialUDP("udp", nil, raddr)
+	conn, err := src.dialer("udp").Dial("udp", raddr.String())
 	if err != nil {
 		check.CheckErrorMessage = err.Error()
 		check.Status = models.StatusError
 		check.StatusCode = 500
 	} else {
 		defer conn.Close()
+		src.setSource(check, conn.LocalAddr())
 		conn.SetDeadline(time.Now().Add(checkTimeout))
 
 		// Try UDP up to 3 times before considering it a failure
@@ -245,77 +326,73 @@ func (c *Checker) checkNetworkUDP(host models.Host, network models.Network) {
 	}
 
 	check.ResponseTime = time.Since(start)
-	if err := host.AddCheck(c.db, check); err != nil {
-		log.Printf("error adding check: %v", err)
-		return
-	}
+	c.saveCheck(host, check, span)
 }
 
-func (c *Checker) checkHealth(host string) (checkResp healthResponse) {
+func (c *Checker) checkHealth(httpClient *http.Client, host string) (checkResp healthResponse) {
+	// Keep the local address of the connection to record the source of the check
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			checkResp.localAddr = info.Conn.LocalAddr()
+		},
+	})
+
 	timer := time.Now()
-	resp, err := c.httpClient.Get(fmt.Sprintf("http://%s/api/health", host))
+	health, resp, err := client.New(host, httpClient).Health(ctx)
 	checkResp.responseTime = time.Since(timer)
-	if err != nil {
+	if resp == nil {
 		checkResp.statusCode = 408
 		checkResp.errorMessage = err
 		return
 	}
-	defer resp.Body.Close()
 
 	checkResp.statusCode = resp.StatusCode
-	if resp.StatusCode > 399 {
-		checkResp.errorMessage = fmt.Errorf("error bad status response: %d", resp.StatusCode)
-		log.Printf("error bad status response: %d", resp.StatusCode)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
+	checkResp.responseBody = string(resp.Body)
 	if err != nil {
 		checkResp.errorMessage = err
-		log.Printf("error reading body from %s health: %v", host, err)
+		log.Printf("error getting health from %s: %v", host, err)
 		return
 	}
-	checkResp.responseBody = string(body)
-
-	// Backwards compatibility to handle remote service still using an int for the ID
-	// Change the ID in the response to a string value
-	r := regexp.MustCompile(`"ID":(\d+),`)
-	body = r.ReplaceAll(body, []byte(`"ID":"${1}",`))
-
-	if err := json.Unmarshal(body, &checkResp); err != nil {
-		checkResp.errorMessage = err
-		log.Printf("error unmarshaling body into struct from %s health: %v", host, err)
+	if health.Host == nil {
+		checkResp.errorMessage = fmt.Errorf("no host in health response")
+		return
 	}
 
+	checkResp.HealthResponse = *health
 	return
 }
 
 // checkForNewHosts will call /api/hosts on the target host and add any hosts that are not currently known
-func (c *Checker) checkForNewHosts(host string) error {
-	resp, err := c.httpClient.Get(fmt.Sprintf("http://%s/api/hosts", host))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+func (c *Checker) checkForNewHosts(httpClient *http.Client, host string) error {
+	hosts, _, err := client.New(host, httpClient).Hosts(context.Background(), "")
 	if err != nil {
 		return err
 	}
 
-	var hosts []models.Host
-	if err := json.Unmarshal(body, &hosts); err != nil {
-		return err
-	}
-
 	for _, h := range hosts {
-		if _, err := models.GetHostByIP(c.db, h.PublicIP); err != nil {
-			if err != badger.ErrKeyNotFound {
+		// Peers reachable only on named networks have no public ip, any known address is enough
+		addrs := h.NetworkAddresses()
+		networks := h.Networks()
+		if len(networks) == 0 {
+			continue
+		}
+
+		known := false
+		for _, network := range networks {
+			if _, err := c.db.GetHostByIP(addrs[network]); err == nil {
+				known = true
+				break
+			} else if err != database.ErrNotFound {
 				return err
 			}
-
-			log.Printf("adding new host %s", h.PublicIP)
-			c.newHost(h.PublicIP)
 		}
+		if known {
+			continue
+		}
+
+		ip := addrs[networks[0]]
+		log.Printf("adding new host %s", ip)
+		c.newHost(ip)
 	}
 
 	return nil
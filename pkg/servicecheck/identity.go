@@ -0,0 +1,89 @@
+package servicecheck
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// verifyIdentity checks that the node that answered on ip is the host that was expected.
+// When a different node answered, the ip is moved over to the host record of that node.
+// Like reconciliation, the hostname at the host's own address decides: a replaced container
+// answering with a new instance id is the same host and takes on the new id.
+func (c *Checker) verifyIdentity(host models.Host, ip, hostname, instanceID string) error {
+	// Older peers do not report who they are
+	if hostname == "" {
+		return nil
+	}
+
+	if hostname == host.Hostname {
+		if instanceID != "" && instanceID != host.InstanceID {
+			host.InstanceID = instanceID
+			if err := c.db.SaveHost(&host); err != nil {
+				log.Printf("error saving host (%s): %v", host.Hostname, err)
+			}
+		}
+		return nil
+	}
+
+	c.releaseIP(host, ip, hostname, instanceID)
+	return fmt.Errorf("expected %s (%s) at %s but %s (%s) responded", host.Hostname, host.InstanceID, ip, hostname, instanceID)
+}
+
+// releaseIP moves the ip to the host that now answers on it and removes it from the expected
+// host so that host is no longer probed on an address that belongs to another node. A host
+// left without addresses stays stored with its history but drops out of the checks.
+func (c *Checker) releaseIP(host models.Host, ip, hostname, instanceID string) {
+	stale, err := c.db.GetHostByID(host.ID)
+	if err != nil {
+		log.Printf("error getting host (%s): %v", host.Hostname, err)
+		return
+	}
+
+	// Another check of this round already moved the ip
+	if !stale.RemoveIP(ip) {
+		return
+	}
+
+	c.rehomeIP(ip, hostname, instanceID)
+	if err := c.db.SaveHost(stale); err != nil {
+		log.Printf("error saving host (%s): %v", stale.Hostname, err)
+	}
+}
+
+// rehomeIP points the ip index at the host that now answers on it, creating the host if it is
+// new. A host with the hostname is the node even with a new instance id, as reconciliation
+// would merge a new host for it back into it.
+func (c *Checker) rehomeIP(ip, hostname, instanceID string) {
+	owner, err := c.db.GetHostByHostname(hostname)
+	if err != nil && err != database.ErrNotFound {
+		log.Printf("error looking up host by hostname (%s) %v", hostname, err)
+		return
+	}
+
+	if owner == nil {
+		log.Printf("adding new host %s found at %s", hostname, ip)
+		c.newHost(ip)
+		return
+	}
+
+	if instanceID != "" && owner.InstanceID != instanceID {
+		owner.InstanceID = instanceID
+		if err := c.db.SaveHost(owner); err != nil {
+			log.Printf("error saving host (%s): %v", owner.Hostname, err)
+			return
+		}
+	}
+
+	if err := c.db.SetIPOwner(owner, ip); err != nil {
+		log.Printf("error moving %s to host (%s): %v", ip, hostname, err)
+		return
+	}
+	c.events.Record(models.NewEvent(
+		models.EventAddressMoved,
+		owner,
+		fmt.Sprintf("moved %s from previous host to %s", ip, hostname),
+	).WithDetail("ip", ip))
+}
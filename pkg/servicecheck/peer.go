@@ -0,0 +1,102 @@
+package servicecheck
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// updatePeer stores what a peer reports about itself in its health when it changed and
+// records the restarts, reboots, address and label changes as events. The host is reloaded before
+// saving so changes saved by other checks are not overwritten.
+func (c *Checker) updatePeer(host models.Host, reported *models.Host) {
+	var events []*models.Event
+
+	now := time.Now().UTC()
+	restart := host.DetectRestart(reported, now)
+	switch restart {
+	case models.RestartService:
+		events = append(events, models.NewEvent(
+			models.EventServiceRestarted,
+			&host,
+			fmt.Sprintf("%s service restarted at %s", host.Hostname, reported.ServiceLastStart.Format(time.RFC3339)),
+		).WithDetail("previousStart", host.ServiceLastStart.Format(time.RFC3339)).WithDetail("restarts", fmt.Sprint(reported.ServiceRestarts)))
+		events[0].At = reported.ServiceLastStart
+	case models.RestartHost:
+		bootedAt := reported.ReportedBootTime(now)
+		events = append(events, models.NewEvent(
+			models.EventHostRebooted,
+			&host,
+			fmt.Sprintf("%s host rebooted at %s", host.Hostname, bootedAt.Format(time.RFC3339)),
+		).WithDetail("previousBoot", host.BootedAt.Format(time.RFC3339)))
+		events[0].At = bootedAt
+	}
+
+	prev, next := host.NetworkAddresses(), reported.NetworkAddresses()
+	for _, network := range reported.Networks() {
+		if prev[network] == "" || prev[network] == next[network] {
+			continue
+		}
+		events = append(events, models.NewEvent(
+			models.EventAddressChanged,
+			&host,
+			fmt.Sprintf("%s %s address changed from %s to %s", host.Hostname, network, prev[network], next[network]),
+		).WithDetail("network", string(network)).WithDetail("from", prev[network]).WithDetail("to", next[network]))
+	}
+
+	labelsChanged := !sameLabels(host.Labels, reported.Labels)
+	if labelsChanged {
+		events = append(events, models.NewEvent(
+			models.EventLabelsChanged,
+			&host,
+			fmt.Sprintf("%s labels changed", host.Hostname),
+		))
+	}
+
+	// The first boot time seen of a peer is stored without counting it as a reboot
+	bootedAt := reported.ReportedBootTime(now)
+	if len(events) == 0 && host.ServiceLastStart.Equal(reported.ServiceLastStart) && (bootedAt.IsZero() || !host.BootedAt.IsZero()) {
+		return
+	}
+
+	current, err := c.db.GetHostByID(host.ID)
+	if err != nil {
+		log.Printf("error getting host (%s): %v", host.Hostname, err)
+		return
+	}
+
+	current.ServiceRestarts = reported.ServiceRestarts
+	current.ServiceFirstStart = reported.ServiceFirstStart
+	current.ServiceLastStart = reported.ServiceLastStart
+	if restart == models.RestartHost || current.BootedAt.IsZero() {
+		current.BootedAt = bootedAt
+	}
+	if restart != models.RestartNone {
+		if current.Restarts == nil {
+			current.Restarts = &models.RestartCounts{}
+		}
+		current.Restarts.Add(restart, events[0].At)
+	}
+	current.InternalIP = reported.InternalIP
+	current.PublicIP = reported.PublicIP
+	current.Addresses = reported.Addresses
+	current.Labels = reported.Labels
+	if err := c.db.SaveHost(current); err != nil {
+		log.Printf("error updating host (%s): %v", host.Hostname, err)
+		return
+	}
+
+	for _, e := range events {
+		c.events.Record(e)
+	}
+}
+
+func sameLabels(a, b map[string]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
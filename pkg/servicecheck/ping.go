@@ -1,9 +1,19 @@
 package servicecheck
 
 import (
+	"context"
 	"errors"
+	"math/rand"
 	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"github.com/digineo/go-ping"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
 )
 
 var errPingDisabled = errors.New("ping disabled")
@@ -20,3 +30,98 @@ func (p *pingNoOp) Close() {}
 func (p *pingNoOp) Ping(ip *net.IPAddr, timeout time.Duration) (time.Duration, error) {
 	return 0, errPingDisabled
 }
+
+// newPinger returns a pinger bound to the address or a no-op pinger when
+// not running with the privileges needed for ICMP
+func newPinger(bind4 string) (pinger, error) {
+	p, err := ping.New(bind4, "")
+	if err != nil {
+		if opErr, ok := err.(*net.OpError); ok && strings.Contains(opErr.Err.Error(), "operation not permitted") {
+			return &pingNoOp{}, nil
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// boundPinger sends each ping from its own ICMP socket set up with the control of the
+// source, so pings can be bound to an interface with SO_BINDTODEVICE which go-ping doesn't
+// allow. Raw sockets get every ICMP reply so replies are matched on the id and sequence.
+type boundPinger struct {
+	control func(network, address string, c syscall.RawConn) error
+	id      int
+	seq     uint32
+}
+
+// newBoundPinger returns a pinger using the control for its sockets or a no-op pinger when
+// not running with the privileges needed for ICMP
+func newBoundPinger(control func(network, address string, c syscall.RawConn) error) (pinger, error) {
+	p := &boundPinger{
+		control: control,
+		id:      rand.Intn(0xffff),
+	}
+
+	conn, err := p.listen()
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return &pingNoOp{}, nil
+		}
+		return nil, err
+	}
+	conn.Close()
+	return p, nil
+}
+
+func (p *boundPinger) Close() {}
+
+func (p *boundPinger) listen() (net.PacketConn, error) {
+	lc := net.ListenConfig{Control: p.control}
+	return lc.ListenPacket(context.Background(), "ip4:icmp", "0.0.0.0")
+}
+
+func (p *boundPinger) Ping(ip *net.IPAddr, timeout time.Duration) (time.Duration, error) {
+	conn, err := p.listen()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	seq := int(atomic.AddUint32(&p.seq, 1) & 0xffff)
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: p.id, Seq: seq, Data: []byte("service_tester")},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	if err := conn.SetDeadline(start.Add(timeout)); err != nil {
+		return 0, err
+	}
+	if _, err := conn.WriteTo(data, ip); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+
+		reply, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || echo.ID != p.id || echo.Seq != seq {
+			continue
+		}
+		if addr, ok := from.(*net.IPAddr); ok && !addr.IP.Equal(ip.IP) {
+			continue
+		}
+		return time.Since(start), nil
+	}
+}
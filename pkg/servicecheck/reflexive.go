@@ -0,0 +1,84 @@
+package servicecheck
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// probeReflexive asks every host for the address it sees our traffic from. All requests
+// go out of the same UDP socket so the replies show whether the NAT mapping depends on
+// the destination.
+func (c *Checker) probeReflexive(hosts []models.Host) {
+	for _, host := range hosts {
+		for _, ip := range host.NetworkAddresses() {
+			raddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", ip, c.cfg.ServicePort))
+			if err != nil {
+				log.Printf("error resolving udp addr %s:%d %v", ip, c.cfg.ServicePort, err)
+				continue
+			}
+
+			if _, err := c.reflexiveConn.WriteToUDP([]byte("addr\n"), raddr); err != nil {
+				log.Printf("error sending reflexive request to %s: %v", raddr, err)
+			}
+		}
+	}
+}
+
+// readReflexive stores replies to probeReflexive until the socket is closed
+func (c *Checker) readReflexive() {
+	for {
+		buf := make([]byte, 512)
+		n, raddr, err := c.reflexiveConn.ReadFromUDP(buf)
+		if err != nil {
+			if !strings.Contains(err.Error(), "use of closed network connection") {
+				log.Printf("error reading reflexive reply: %v", err)
+			}
+			return
+		}
+
+		reply := strings.TrimSpace(string(buf[:n]))
+		if !strings.HasPrefix(reply, "addr ") {
+			continue
+		}
+
+		host, err := c.db.GetHostByIP(raddr.IP.String())
+		if err != nil {
+			if err != database.ErrNotFound {
+				log.Printf("error looking up host by ip (%s) %v", raddr.IP, err)
+			}
+			continue
+		}
+
+		c.saveReflexive(*host, host.NetworkForIP(raddr.IP.String()), models.CheckUDP, c.reflexiveConn.LocalAddr(), strings.TrimPrefix(reply, "addr "))
+	}
+}
+
+// saveReflexive records the address the host observed for one of our probes
+func (c *Checker) saveReflexive(host models.Host, network models.Network, checkType models.CheckType, local net.Addr, observed string) {
+	if observed == "" {
+		return
+	}
+
+	var localPort int
+	switch addr := local.(type) {
+	case *net.UDPAddr:
+		localPort = addr.Port
+	case *net.TCPAddr:
+		localPort = addr.Port
+	}
+
+	o, err := models.NewReflexiveObservation(&host, network, checkType, localPort, observed)
+	if err != nil {
+		log.Printf("error parsing observed address %q from %s: %v", observed, host.Hostname, err)
+		return
+	}
+
+	if err := c.db.SaveReflexiveObservation(o); err != nil {
+		log.Printf("error saving reflexive address from %s: %v", host.Hostname, err)
+	}
+}
@@ -0,0 +1,119 @@
+package servicecheck
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// probeSource is where the probes for a network are sent from. Without a configured
+// source ip or interface the kernel picks the route like any other connection.
+type probeSource struct {
+	ip         net.IP
+	iface      string
+	control    func(network, address string, c syscall.RawConn) error
+	httpClient *http.Client
+	pinger     pinger
+}
+
+// newProbeSource builds a source from an ip or interface name
+func newProbeSource(value string) (*probeSource, error) {
+	src := &probeSource{}
+	if ip := net.ParseIP(value); ip != nil {
+		src.ip = ip
+	} else {
+		if _, err := net.InterfaceByName(value); err != nil {
+			return nil, err
+		}
+
+		src.iface = value
+		if err := bindToInterface(src); err != nil {
+			return nil, err
+		}
+	}
+
+	// Pings are bound to the interface like every other probe when the platform can, and to
+	// the address otherwise. Only ipv4 is pinged so ipv6 source addresses don't ping.
+	var err error
+	switch {
+	case src.control != nil:
+		src.pinger, err = newBoundPinger(src.control)
+	case src.ip.To4() != nil:
+		src.pinger, err = newPinger(src.ip.String())
+	default:
+		log.Printf("ICMP checks from %s are disabled, only ipv4 sources can ping", value)
+		src.pinger = &pingNoOp{}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	src.httpClient = &http.Client{
+		Timeout: checkTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return src.dialer(network).DialContext(ctx, network, addr)
+			},
+		},
+	}
+
+	return src, nil
+}
+
+// dialer returns a dialer bound to the source for tcp or udp
+func (s *probeSource) dialer(network string) *net.Dialer {
+	d := &net.Dialer{
+		Timeout: checkTimeout,
+		Control: s.control,
+	}
+
+	if s.ip != nil {
+		switch network {
+		case "tcp", "tcp4", "tcp6":
+			d.LocalAddr = &net.TCPAddr{IP: s.ip}
+		case "udp", "udp4", "udp6":
+			d.LocalAddr = &net.UDPAddr{IP: s.ip}
+		}
+	}
+	return d
+}
+
+// setSource records the local address and interface a probe was sent from
+func (s *probeSource) setSource(check *models.Check, local net.Addr) {
+	check.SourceInterface = s.iface
+	switch addr := local.(type) {
+	case *net.TCPAddr:
+		check.SourceIP = addr.IP.String()
+	case *net.UDPAddr:
+		check.SourceIP = addr.IP.String()
+	}
+}
+
+// routeSource returns the local address the kernel picks to reach the ip from the source.
+// ICMP has no connection to take the local address from so a udp socket is connected,
+// which sends nothing, to look up the route.
+func (s *probeSource) routeSource(ip string) net.Addr {
+	conn, err := s.dialer("udp").Dial("udp", net.JoinHostPort(ip, "9"))
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	return conn.LocalAddr()
+}
+
+func (s *probeSource) close() {
+	s.httpClient.CloseIdleConnections()
+	s.pinger.Close()
+}
+
+// source returns the source configured for the network or the default one
+func (c *Checker) source(network models.Network) *probeSource {
+	if src, ok := c.sources[network]; ok {
+		return src
+	}
+	return c.defaultSource
+}
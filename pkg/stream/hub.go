@@ -0,0 +1,228 @@
+package stream
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// subscriptionBuffer is how many messages a subscriber can fall behind before messages
+// are dropped for it
+const subscriptionBuffer = 256
+
+type MessageType string
+
+const (
+	MessageCheck MessageType = "check"
+	MessageState MessageType = "state"
+	MessageEvent MessageType = "event"
+
+	// MessageDropped tells a subscriber that fell behind how many messages it missed, so it
+	// can reload what it shows
+	MessageDropped MessageType = "dropped"
+)
+
+// Message is a new check, a change in the state of a series of checks or an event of the mesh
+type Message struct {
+	Type      MessageType      `json:"type"`
+	HostID    string           `json:"hostId,omitempty"`
+	Hostname  string           `json:"hostname,omitempty"`
+	Network   models.Network   `json:"network,omitempty"`
+	CheckType models.CheckType `json:"checkType,omitempty"`
+	At        time.Time        `json:"at"`
+	Check     *models.Check    `json:"check,omitempty"`
+	State     *StateChange     `json:"state,omitempty"`
+	Event     *models.Event    `json:"event,omitempty"`
+	Dropped   uint64           `json:"dropped,omitempty"`
+}
+
+// StateChange is a series of checks going from up to down or back
+type StateChange struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	stateUp   = "up"
+	stateDown = "down"
+)
+
+// Filter selects the messages of a subscription. Empty fields match everything, events
+// only have a host so they are not sent when filtering by network or type.
+type Filter struct {
+	HostID    string
+	Network   models.Network
+	CheckType models.CheckType
+	Types     []MessageType
+}
+
+func (f Filter) Match(m *Message) bool {
+	if f.HostID != "" && m.HostID != f.HostID {
+		return false
+	}
+	if f.Network != "" && m.Network != f.Network {
+		return false
+	}
+	if f.CheckType != "" && !strings.EqualFold(string(m.CheckType), string(f.CheckType)) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if m.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives the messages matching its filter until it is closed
+type Subscription struct {
+	C       <-chan *Message
+	c       chan *Message
+	filter  Filter
+	dropped uint64
+
+	// reported is how many of the dropped messages were already in a notice
+	reported uint64
+}
+
+// Dropped is how many messages were not sent because the subscriber fell behind
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// DroppedNotice returns a message with the number of messages dropped since the last notice,
+// or nil when none were. It is called by the one reader of the subscription.
+func (s *Subscription) DroppedNotice() *Message {
+	dropped := s.Dropped()
+	if dropped == s.reported {
+		return nil
+	}
+
+	notice := &Message{Type: MessageDropped, At: time.Now().UTC(), Dropped: dropped - s.reported}
+	s.reported = dropped
+	return notice
+}
+
+type series struct {
+	hostID    string
+	network   models.Network
+	checkType models.CheckType
+}
+
+// Hub fans the checks and events of the checker out to the subscribers of the live stream
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]bool
+	states map[series]string
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs:   make(map[*Subscription]bool),
+		states: make(map[series]string),
+	}
+}
+
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	c := make(chan *Message, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, filter: filter}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[sub] = true
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[sub] {
+		delete(h.subs, sub)
+		close(sub.c)
+	}
+}
+
+// PublishCheck sends the check, and a state change when the series went up or down
+func (h *Hub) PublishCheck(host *models.Host, check *models.Check) {
+	msg := &Message{
+		Type:      MessageCheck,
+		HostID:    host.ID,
+		Hostname:  host.Hostname,
+		Network:   check.Network,
+		CheckType: check.CheckType,
+		At:        check.CheckedAt,
+		Check:     check,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publish(msg)
+
+	// Checks that couldn't run say nothing about the state of the series
+	if check.Status == models.StatusUnknown {
+		return
+	}
+
+	state := stateUp
+	if check.Failed() {
+		state = stateDown
+	}
+	s := series{hostID: host.ID, network: check.Network, checkType: check.CheckType}
+	prev, ok := h.states[s]
+	h.states[s] = state
+	if !ok || prev == state {
+		return
+	}
+
+	change := *msg
+	change.Type = MessageState
+	change.Check = nil
+	change.State = &StateChange{From: prev, To: state, Error: check.CheckErrorMessage}
+	h.publish(&change)
+}
+
+// Prune forgets the state of the series of hosts that are no longer checked, so the next
+// check of a host that comes back starts its series again
+func (h *Hub) Prune(hostIDs map[string]bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.states {
+		if !hostIDs[s.hostID] {
+			delete(h.states, s)
+		}
+	}
+}
+
+// PublishEvent sends an event of the mesh
+func (h *Hub) PublishEvent(e *models.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publish(&Message{
+		Type:     MessageEvent,
+		HostID:   e.HostID,
+		Hostname: e.Hostname,
+		At:       e.At,
+		Event:    e,
+	})
+}
+
+// publish never blocks the checker, a subscriber that fell behind misses the message
+func (h *Hub) publish(msg *Message) {
+	for sub := range h.subs {
+		if !sub.filter.Match(msg) {
+			continue
+		}
+		select {
+		case sub.c <- msg:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
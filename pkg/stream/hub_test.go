@@ -0,0 +1,158 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+)
+
+// drain returns the messages waiting for the subscriber
+func drain(sub *Subscription) []*Message {
+	var msgs []*Message
+	for {
+		select {
+		case msg := <-sub.C:
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func newCheck(network models.Network, checkType models.CheckType, status models.Status) *models.Check {
+	return &models.Check{Network: network, CheckType: checkType, Status: status}
+}
+
+func TestFilterMatch(t *testing.T) {
+	check := &Message{Type: MessageCheck, HostID: "1", Network: models.NetworkPublic, CheckType: models.CheckTCP}
+	event := &Message{Type: MessageEvent, HostID: "1"}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		msg    *Message
+		match  bool
+	}{
+		{"empty", Filter{}, check, true},
+		{"host", Filter{HostID: "1"}, check, true},
+		{"other host", Filter{HostID: "2"}, check, false},
+		{"network", Filter{Network: models.NetworkPublic}, check, true},
+		{"other network", Filter{Network: models.NetworkInternal}, check, false},
+		{"type in any case", Filter{CheckType: "tcp"}, check, true},
+		{"other type", Filter{CheckType: models.CheckUDP}, check, false},
+		{"kind", Filter{Types: []MessageType{MessageState, MessageCheck}}, check, true},
+		{"other kind", Filter{Types: []MessageType{MessageState}}, check, false},
+		{"event of the host", Filter{HostID: "1", Types: []MessageType{MessageEvent}}, event, true},
+		{"event by network", Filter{Network: models.NetworkPublic}, event, false},
+		{"event by type", Filter{CheckType: models.CheckTCP}, event, false},
+	}
+
+	for _, test := range tests {
+		if got := test.filter.Match(test.msg); got != test.match {
+			t.Errorf("%s: expected match %v, got %v", test.name, test.match, got)
+		}
+	}
+}
+
+func TestHubPublish(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe(Filter{HostID: "1"})
+	defer h.Unsubscribe(sub)
+
+	host := &models.Host{ID: "1", Hostname: "a"}
+	other := &models.Host{ID: "2", Hostname: "b"}
+
+	h.PublishCheck(host, newCheck(models.NetworkPublic, models.CheckTCP, models.StatusSuccess))
+	h.PublishCheck(other, newCheck(models.NetworkPublic, models.CheckTCP, models.StatusError))
+	h.PublishCheck(host, newCheck(models.NetworkPublic, models.CheckTCP, models.StatusUnknown))
+	h.PublishCheck(host, newCheck(models.NetworkPublic, models.CheckTCP, models.StatusError))
+	h.PublishEvent(&models.Event{HostID: "1", Hostname: "a"})
+
+	msgs := drain(sub)
+	var types []MessageType
+	for _, msg := range msgs {
+		if msg.HostID != "1" {
+			t.Errorf("expected only messages of the host, got %+v", msg)
+		}
+		types = append(types, msg.Type)
+	}
+
+	// The first check only sets the state and a check that couldn't run doesn't change it
+	expected := []MessageType{MessageCheck, MessageCheck, MessageCheck, MessageState, MessageEvent}
+	if len(types) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, types)
+		}
+	}
+	if s := msgs[3].State; s == nil || s.From != stateUp || s.To != stateDown {
+		t.Errorf("expected the series to go down, got %+v", s)
+	}
+}
+
+func TestHubDropped(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe(Filter{})
+	defer h.Unsubscribe(sub)
+
+	host := &models.Host{ID: "1"}
+	publish := func(n int) {
+		for i := 0; i < n; i++ {
+			h.PublishCheck(host, newCheck(models.NetworkPublic, models.CheckTCP, models.StatusUnknown))
+		}
+	}
+
+	if notice := sub.DroppedNotice(); notice != nil {
+		t.Errorf("expected no notice before anything is dropped, got %+v", notice)
+	}
+
+	publish(subscriptionBuffer + 3)
+	if sub.Dropped() != 3 {
+		t.Errorf("expected 3 messages dropped, got %d", sub.Dropped())
+	}
+	if len(drain(sub)) != subscriptionBuffer {
+		t.Errorf("expected the buffer to be full")
+	}
+
+	notice := sub.DroppedNotice()
+	if notice == nil || notice.Type != MessageDropped || notice.Dropped != 3 {
+		t.Fatalf("expected a notice of 3 dropped messages, got %+v", notice)
+	}
+	if notice := sub.DroppedNotice(); notice != nil {
+		t.Errorf("expected no notice until more are dropped, got %+v", notice)
+	}
+
+	// Only the messages dropped since the last notice are counted in the next
+	publish(subscriptionBuffer + 2)
+	if notice := sub.DroppedNotice(); notice == nil || notice.Dropped != 2 || sub.Dropped() != 5 {
+		t.Errorf("expected a notice of 2 more dropped messages, got %+v", notice)
+	}
+}
+
+func TestHubPrune(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe(Filter{Types: []MessageType{MessageState}})
+	defer h.Unsubscribe(sub)
+
+	kept := &models.Host{ID: "1"}
+	pruned := &models.Host{ID: "2"}
+	for _, host := range []*models.Host{kept, pruned} {
+		h.PublishCheck(host, newCheck(models.NetworkPublic, models.CheckTCP, models.StatusSuccess))
+	}
+
+	h.Prune(map[string]bool{kept.ID: true})
+
+	// The series of the pruned host starts again so its failure is not a change of state
+	for _, host := range []*models.Host{kept, pruned} {
+		h.PublishCheck(host, newCheck(models.NetworkPublic, models.CheckTCP, models.StatusError))
+	}
+	msgs := drain(sub)
+	if len(msgs) != 1 || msgs[0].HostID != kept.ID {
+		t.Fatalf("expected only the kept host to go down, got %+v", msgs)
+	}
+	if len(h.states) != 2 {
+		t.Errorf("expected both series to be tracked again, got %v", h.states)
+	}
+}
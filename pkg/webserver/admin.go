@@ -0,0 +1,116 @@
+package webserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	apiv1 "github.com/brentahughes/service_tester/pkg/api/v1"
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/export"
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdmin only lets requests with the admin token through. The admin api is on the
+// same port every peer calls, so it is disabled unless a token is configured.
+func (s *Server) requireAdmin(c *gin.Context) {
+	if s.config.AdminToken == "" {
+		s.writeErr(c, http.StatusForbidden, errors.New("the admin api is disabled, set ADMIN_TOKEN to enable it"))
+		c.Abort()
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) != 1 {
+		c.Header("WWW-Authenticate", "Bearer")
+		s.writeErr(c, http.StatusUnauthorized, errors.New("invalid admin token"))
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// reconcile merges duplicate hosts and cleans stale index entries now instead of waiting for the next interval
+func (s *Server) reconcile(c *gin.Context) {
+	report, err := database.Reconcile(s.db, s.events)
+	if err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// backup streams a consistent backup of the database that can be loaded with the restore command
+func (s *Server) backup(c *gin.Context) {
+	backupable, ok := s.db.(database.Backupable)
+	if !ok {
+		s.writeErr(c, http.StatusNotImplemented, fmt.Errorf("the %s backend can't be backed up", s.config.DBBackend))
+		return
+	}
+
+	filename := fmt.Sprintf("service_tester-%s.bak", time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Status(http.StatusOK)
+
+	// The status is already sent once streaming starts so errors can only be logged
+	if err := backupable.Backup(c.Writer); err != nil {
+		log.Printf("error streaming backup: %v", err)
+	}
+}
+
+// export streams the hosts, checks or rollups as ndjson or csv. Checks and rollups can be
+// limited with start and end (RFC3339) and rollups exported at a resolution.
+func (s *Server) export(c *gin.Context) {
+	opts := export.Options{
+		Kind:       c.Param("kind"),
+		Format:     c.Query("format"),
+		Resolution: models.Resolution(c.Query("resolution")),
+	}
+	for param, t := range map[string]*time.Time{"start": &opts.Start, "end": &opts.End} {
+		if str := c.Query(param); str != "" {
+			var err error
+			*t, err = time.Parse(time.RFC3339, str)
+			if err != nil {
+				s.writeErr(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+
+	if err := opts.Validate(); err != nil {
+		s.writeErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.Header("Content-Type", opts.ContentType())
+	c.Status(http.StatusOK)
+	if err := export.Write(s.db, c.Writer, opts); err != nil {
+		log.Printf("error streaming %s export: %v", opts.Kind, err)
+	}
+}
+
+// writerStats returns the depth of the write queue and how batches are being written
+func (s *Server) writerStats(c *gin.Context) {
+	pipelined, ok := s.db.(database.Pipelined)
+	if !ok {
+		s.writeErr(c, http.StatusNotImplemented, fmt.Errorf("the %s backend writes directly", s.config.DBBackend))
+		return
+	}
+	stats := pipelined.WriterStats()
+	c.JSON(http.StatusOK, apiv1.WriterStats{
+		QueueDepth:        stats.QueueDepth,
+		QueueCapacity:     stats.QueueCapacity,
+		Batches:           stats.Batches,
+		Writes:            stats.Writes,
+		Conflicts:         stats.Conflicts,
+		Errors:            stats.Errors,
+		LastBatchSize:     stats.LastBatchSize,
+		LastBatchDuration: stats.LastBatchDuration,
+	})
+}
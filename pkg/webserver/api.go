@@ -3,6 +3,8 @@ package webserver
 import (
 	"net/http"
 
+	apiv1 "github.com/brentahughes/service_tester/pkg/api/v1"
+	"github.com/brentahughes/service_tester/pkg/database"
 	"github.com/brentahughes/service_tester/pkg/models"
 	"github.com/gin-gonic/gin"
 )
@@ -10,33 +12,103 @@ import (
 func (s *Server) setupAPIEndpoints() {
 	api := s.router.Group("/api")
 	api.GET("/health", s.getHealth)
+	api.GET("/health/inbound", s.getInboundHealth)
 	api.GET("/hosts", s.getHosts)
 	api.GET("/hosts/:id", s.getHost)
+	api.GET("/hosts/:id/history", s.getHostHistory)
+	api.GET("/hosts/:id/checks", s.getChecks)
+	api.GET("/hosts/:id/restarts", s.getHostRestarts)
+	api.GET("/checks", s.getChecks)
+	api.GET("/incidents", s.getIncidents)
+	api.GET("/events", s.getEvents)
+	api.GET("/stream", s.getStream)
+	api.GET("/mesh", s.getMesh)
+	api.GET("/results/:hostname", s.getResults)
+
+	admin := api.Group("/admin", s.requireAdmin)
+	admin.POST("/reconcile", s.reconcile)
+	admin.GET("/backup", s.backup)
+	admin.GET("/export/:kind", s.export)
+	admin.GET("/writer", s.writerStats)
+	admin.DELETE("/hosts/:id/uptime", s.resetHostUptime)
 }
 
 func (s *Server) getHealth(c *gin.Context) {
-	currentHost, err := models.GetCurrentHost(s.db)
+	currentHost, err := database.GetCurrentHost(s.db)
 	if err != nil {
 		s.writeErr(c, http.StatusInternalServerError, err)
 		return
 	}
-	c.JSON(http.StatusOK, currentHost)
+
+	reflexive, err := database.GetReflexiveAddress(s.db, currentHost)
+	if err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apiv1.HealthResponse{
+		Host:         currentHost,
+		ObservedAddr: c.Request.RemoteAddr,
+		Reflexive:    reflexive,
+	})
 }
 
+// getHosts returns every host, or the hosts with labels matching ?selector= (ex. region=us-east,provider!=aws)
 func (s *Server) getHosts(c *gin.Context) {
-	hosts, err := models.GetHostsWithStatuses(s.db)
+	selector, err := models.ParseSelector(c.Query("selector"))
+	if err != nil {
+		s.writeErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	hosts, err := s.db.GetHostsWithStatuses()
 	if err != nil {
 		s.writeErr(c, http.StatusInternalServerError, err)
 		return
 	}
+	hosts = selector.FilterHosts(hosts)
+	if hosts == nil {
+		hosts = []models.Host{}
+	}
+
+	for i := range hosts {
+		if err := database.SetLatency(s.db, &hosts[i]); err != nil {
+			s.writeErr(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
 	c.JSON(http.StatusOK, hosts)
 }
 
 func (s *Server) getHost(c *gin.Context) {
-	host, err := models.GetHostByID(s.db, c.Param("id"))
+	host, err := s.db.GetHostByID(c.Param("id"))
 	if err != nil {
 		s.writeErr(c, http.StatusInternalServerError, err)
 		return
 	}
+
+	if err := database.SetLatency(s.db, host); err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
 	c.JSON(http.StatusOK, host)
 }
+
+// resetHostUptime clears the uptime counters of the host in every window
+func (s *Server) resetHostUptime(c *gin.Context) {
+	host, err := s.db.GetHostByID(c.Param("id"))
+	if err != nil {
+		if err == database.ErrNotFound {
+			s.writeErr(c, http.StatusNotFound, err)
+			return
+		}
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.db.ResetUptime(host.ID); err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
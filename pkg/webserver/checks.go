@@ -0,0 +1,55 @@
+package webserver
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// getChecks returns a page of the checks of every host, or the host in the path, between start and end
+// (RFC3339, default the last hour) filtered by network, type and status. Pass next from a
+// page as ?cursor= to get the following page.
+func (s *Server) getChecks(c *gin.Context) {
+	start, end, err := parseTimeRange(c)
+	if err != nil {
+		s.writeErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	q := models.CheckQuery{
+		HostID:    c.Param("id"),
+		Network:   models.Network(c.Query("network")),
+		CheckType: models.CheckType(c.Query("type")),
+		Status:    models.Status(c.Query("status")),
+		Start:     start,
+		End:       end,
+	}
+	if q.HostID == "" {
+		q.HostID = c.Query("host")
+	}
+
+	if str := c.Query("limit"); str != "" {
+		q.Limit, err = strconv.Atoi(str)
+		if err != nil {
+			s.writeErr(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if str := c.Query("cursor"); str != "" {
+		q.After, err = models.ParseCheckCursor(str)
+		if err != nil {
+			s.writeErr(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	page, err := s.db.QueryChecks(q)
+	if err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,60 @@
+package webserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// getEvents returns a page of the events of the mesh oldest first, filtered by host, a comma
+// separated list of types and the range they happened in with start and end (RFC3339, default
+// the last day). Pass next from a page as ?cursor= to get the following page.
+func (s *Server) getEvents(c *gin.Context) {
+	filter, err := parseEventFilter(c, time.Now().UTC().Add(-24*time.Hour))
+	if err != nil {
+		s.writeErr(c, http.StatusBadRequest, err)
+		return
+	}
+	filter.HostID = c.Query("host")
+
+	page, err := s.db.GetEvents(filter)
+	if err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// parseEventFilter reads the type, start, end, limit and cursor of an event query
+func parseEventFilter(c *gin.Context, defaultStart time.Time) (filter models.EventFilter, err error) {
+	filter.Start = defaultStart
+	if str := c.Query("type"); str != "" {
+		for _, t := range strings.Split(str, ",") {
+			filter.Types = append(filter.Types, models.EventType(t))
+		}
+	}
+
+	for param, t := range map[string]*time.Time{"start": &filter.Start, "end": &filter.End} {
+		if str := c.Query(param); str != "" {
+			*t, err = time.Parse(time.RFC3339, str)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	if str := c.Query("limit"); str != "" {
+		if filter.Limit, err = strconv.Atoi(str); err != nil {
+			return
+		}
+	}
+
+	if str := c.Query("cursor"); str != "" {
+		filter.After, err = models.ParseCursor(str)
+	}
+	return
+}
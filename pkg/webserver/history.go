@@ -0,0 +1,99 @@
+package webserver
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	apiv1 "github.com/brentahughes/service_tester/pkg/api/v1"
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// maxPoints limits how many windows of a series are returned before switching to a coarser resolution
+const maxPoints = 500
+
+// parseTimeRange reads start and end (RFC3339) from the query, by default the last hour
+func parseTimeRange(c *gin.Context) (start, end time.Time, err error) {
+	end = time.Now().UTC()
+	if str := c.Query("end"); str != "" {
+		end, err = time.Parse(time.RFC3339, str)
+		if err != nil {
+			return
+		}
+	}
+
+	start = end.Add(-time.Hour)
+	if str := c.Query("start"); str != "" {
+		start, err = time.Parse(time.RFC3339, str)
+		if err != nil {
+			return
+		}
+	}
+
+	if !start.Before(end) {
+		err = errors.New("start must be before end")
+	}
+	return
+}
+
+// getHostHistory returns the rollups of a host between start and end (RFC3339, default the last hour).
+// The resolution is the finest one that is still retained for the start of the range and
+// doesn't return more than maxPoints windows per series, unless set with ?resolution=.
+func (s *Server) getHostHistory(c *gin.Context) {
+	start, end, err := parseTimeRange(c)
+	if err != nil {
+		s.writeErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	resolution := models.Resolution(c.Query("resolution"))
+	if resolution == "" {
+		resolution = s.chooseResolution(start, end)
+	} else if resolution.Duration() == 0 {
+		s.writeErr(c, http.StatusBadRequest, errors.New("resolution must be minute, hour or day"))
+		return
+	}
+
+	rollups, err := s.db.GetRollups(models.RollupFilter{
+		HostID:     c.Param("id"),
+		Resolution: resolution,
+		Network:    models.Network(c.Query("network")),
+		CheckType:  models.CheckType(c.Query("type")),
+		Start:      start,
+		End:        end,
+	})
+	if err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	if rollups == nil {
+		rollups = []models.Rollup{}
+	}
+
+	c.JSON(http.StatusOK, apiv1.HistoryResponse{
+		Resolution: resolution,
+		Start:      start,
+		End:        end,
+		Rollups:    rollups,
+	})
+}
+
+func (s *Server) chooseResolution(start, end time.Time) models.Resolution {
+	retention := map[models.Resolution]time.Duration{
+		models.ResolutionMinute: s.config.Retention.Minute,
+		models.ResolutionHour:   s.config.Retention.Hour,
+		models.ResolutionDay:    s.config.Retention.Day,
+	}
+
+	for _, resolution := range models.Resolutions {
+		if time.Since(start) > retention[resolution] {
+			continue
+		}
+		if end.Sub(start)/resolution.Duration() > maxPoints {
+			continue
+		}
+		return resolution
+	}
+	return models.ResolutionDay
+}
@@ -0,0 +1,68 @@
+package webserver
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// getIncidents returns a page of the incidents with the most recently started first, filtered
+// by host, network, type, open=true and the range they overlap with start and end (RFC3339).
+// Pass next from a page as ?cursor= to get the following page.
+func (s *Server) getIncidents(c *gin.Context) {
+	filter := models.IncidentFilter{
+		HostID:    c.Query("host"),
+		Network:   models.Network(c.Query("network")),
+		CheckType: models.CheckType(c.Query("type")),
+	}
+
+	var err error
+	if str := c.Query("open"); str != "" {
+		filter.OpenOnly, err = strconv.ParseBool(str)
+		if err != nil {
+			s.writeErr(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	for param, t := range map[string]*time.Time{"start": &filter.Start, "end": &filter.End} {
+		if str := c.Query(param); str != "" {
+			*t, err = time.Parse(time.RFC3339, str)
+			if err != nil {
+				s.writeErr(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+
+	if str := c.Query("limit"); str != "" {
+		filter.Limit, err = strconv.Atoi(str)
+		if err != nil {
+			s.writeErr(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if str := c.Query("cursor"); str != "" {
+		filter.After, err = models.ParseCursor(str)
+		if err != nil {
+			s.writeErr(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	page, err := s.db.GetIncidents(filter)
+	if err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now()
+	for i := range page.Incidents {
+		page.Incidents[i].SetDuration(now)
+	}
+	c.JSON(http.StatusOK, page)
+}
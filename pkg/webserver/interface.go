@@ -5,7 +5,7 @@ import (
 	"html/template"
 	"net/http"
 
-	"github.com/asdine/storm"
+	"github.com/brentahughes/service_tester/pkg/database"
 	"github.com/brentahughes/service_tester/pkg/models"
 	"github.com/gin-gonic/contrib/static"
 	"github.com/gin-gonic/gin"
@@ -26,15 +26,15 @@ func (s *Server) setupInterfaceEndpoints() {
 }
 
 func (s *Server) dashboard(c *gin.Context) {
-	currentHost, err := models.GetCurrentHost(s.db)
-	if err != nil && err != storm.ErrNotFound {
+	currentHost, err := database.GetCurrentHost(s.db)
+	if err != nil && err != database.ErrNotFound {
 		s.writeErr(c, http.StatusInternalServerError, err)
 		return
 	}
 
-	hosts, err := models.GetHostsWithStatuses(s.db)
+	hosts, err := s.db.GetHostsWithStatuses()
 	if err != nil {
-		if err != storm.ErrNotFound {
+		if err != database.ErrNotFound {
 			s.writeErr(c, http.StatusInternalServerError, err)
 			return
 		}
@@ -80,19 +80,19 @@ type detailsData struct {
 }
 
 func (s *Server) hostDetails(c *gin.Context) {
-	currentHost, err := models.GetCurrentHost(s.db)
+	currentHost, err := database.GetCurrentHost(s.db)
 	if err != nil {
 		s.writeErr(c, http.StatusInternalServerError, err)
 		return
 	}
 
-	hosts, err := models.GetHosts(s.db)
+	hosts, err := s.db.GetHosts()
 	if err != nil {
 		s.writeErr(c, http.StatusInternalServerError, err)
 		return
 	}
 
-	host, err := models.GetHostByID(s.db, c.Param("id"))
+	host, err := s.db.GetHostByID(c.Param("id"))
 	if err != nil {
 		s.writeErr(c, http.StatusInternalServerError, err)
 		return
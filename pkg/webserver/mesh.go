@@ -0,0 +1,81 @@
+package webserver
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/brentahughes/service_tester/pkg/mesh"
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// getMesh returns the results of every node against every other node, collected from the
+// api of each peer. Peers that can't be reached are listed in the sources with the error.
+// The matrix is cached unless refresh=true and the cells can be limited to a network.
+func (s *Server) getMesh(c *gin.Context) {
+	refresh, err := parseRefresh(c)
+	if err != nil {
+		s.writeErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	matrix, err := s.mesh.Matrix(refresh)
+	if err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	network := models.Network(c.Query("network"))
+	if network == "" {
+		c.JSON(http.StatusOK, matrix)
+		return
+	}
+
+	// The cached matrix is shared so the filtered cells go into a copy
+	filtered := *matrix
+	filtered.Cells = []models.MeshCell{}
+	for _, cell := range matrix.Cells {
+		if cell.Network == network {
+			filtered.Cells = append(filtered.Cells, cell)
+		}
+	}
+	c.JSON(http.StatusOK, filtered)
+}
+
+// getResults returns the results of this node against the host with the hostname, for
+// peers to find out what this node sees of them
+func (s *Server) getResults(c *gin.Context) {
+	results, err := mesh.Results(s.db, c.Param("hostname"))
+	if err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// getInboundHealth returns the results every peer has recorded against this node, collected
+// from their api and cached unless refresh=true. Peers that can't be reached are listed in
+// the sources with the error.
+func (s *Server) getInboundHealth(c *gin.Context) {
+	refresh, err := parseRefresh(c)
+	if err != nil {
+		s.writeErr(c, http.StatusBadRequest, err)
+		return
+	}
+
+	inbound, err := s.mesh.Inbound(refresh)
+	if err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, inbound)
+}
+
+// parseRefresh reads ?refresh= of the views collected from every peer
+func parseRefresh(c *gin.Context) (bool, error) {
+	str := c.Query("refresh")
+	if str == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(str)
+}
@@ -0,0 +1,17 @@
+package webserver
+
+import (
+	"net/http"
+
+	"github.com/brentahughes/service_tester/pkg/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// getMetrics returns the metrics of this node in the Prometheus text format
+func (s *Server) getMetrics(c *gin.Context) {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", metrics.ContentType)
+	if err := metrics.WriteText(c.Writer, s.metrics.Gather()); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,55 @@
+package webserver
+
+import (
+	"net/http"
+	"time"
+
+	apiv1 "github.com/brentahughes/service_tester/pkg/api/v1"
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// getHostRestarts returns the service restarts and host reboots of a peer seen by this node
+// and a page of their timeline oldest first, limited to the range with start and end (RFC3339).
+// Pass next from a response as ?cursor= to get the following page of the timeline.
+func (s *Server) getHostRestarts(c *gin.Context) {
+	host, err := s.db.GetHostByID(c.Param("id"))
+	if err != nil {
+		if err == database.ErrNotFound {
+			s.writeErr(c, http.StatusNotFound, err)
+			return
+		}
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	filter, err := parseEventFilter(c, time.Time{})
+	if err != nil {
+		s.writeErr(c, http.StatusBadRequest, err)
+		return
+	}
+	filter.HostID = host.ID
+	filter.Types = []models.EventType{models.EventServiceRestarted, models.EventHostRebooted}
+
+	page, err := s.db.GetEvents(filter)
+	if err != nil {
+		s.writeErr(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	counts := host.Restarts
+	if counts == nil {
+		counts = &models.RestartCounts{}
+	}
+	c.JSON(http.StatusOK, apiv1.RestartsResponse{
+		HostID:           host.ID,
+		Hostname:         host.Hostname,
+		ServiceRestarts:  host.ServiceRestarts,
+		ServiceLastStart: host.ServiceLastStart,
+		BootedAt:         host.BootedAt,
+		Counts:           counts,
+		Timeline:         page.Events,
+		Next:             page.Next,
+	})
+}
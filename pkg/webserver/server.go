@@ -4,28 +4,35 @@ import (
 	"fmt"
 	"log"
 
+	apiv1 "github.com/brentahughes/service_tester/pkg/api/v1"
 	"github.com/brentahughes/service_tester/pkg/config"
-	"github.com/dgraph-io/badger"
+	"github.com/brentahughes/service_tester/pkg/database"
+	"github.com/brentahughes/service_tester/pkg/mesh"
+	"github.com/brentahughes/service_tester/pkg/metrics"
+	"github.com/brentahughes/service_tester/pkg/stream"
 	"github.com/gin-gonic/gin"
 )
 
 type Server struct {
-	config config.Config
-	db     *badger.DB
-	port   int
-	router *gin.Engine
+	config  config.Config
+	db      database.Store
+	metrics *metrics.Registry
+	hub     *stream.Hub
+	events  *database.EventLog
+	mesh    *mesh.Collector
+	port    int
+	router  *gin.Engine
 }
 
-type errResponse struct {
-	Type    string `json:"type"`
-	Message string `json:"message"`
-}
-
-func NewServer(config config.Config, db *badger.DB, port int) *Server {
+func NewServer(config config.Config, db database.Store, port int, registry *metrics.Registry, hub *stream.Hub, events *database.EventLog) *Server {
 	return &Server{
-		db:     db,
-		port:   port,
-		config: config,
+		db:      db,
+		metrics: registry,
+		hub:     hub,
+		events:  events,
+		mesh:    mesh.NewCollector(db, &config),
+		port:    port,
+		config:  config,
 	}
 }
 
@@ -36,6 +43,7 @@ func (s *Server) Start() error {
 	s.router.Use(gin.Recovery(), gin.Logger())
 	s.setupInterfaceEndpoints()
 	s.setupAPIEndpoints()
+	s.router.GET("/metrics", s.getMetrics)
 
 	log.Printf("web interface listening on :%d", s.port)
 	return s.router.Run(fmt.Sprintf(":%d", s.port))
@@ -46,7 +54,7 @@ func (s *Server) Stop() {
 }
 
 func (s *Server) writeErr(c *gin.Context, code int, err error) {
-	c.JSON(code, &errResponse{
+	c.JSON(code, &apiv1.ErrorResponse{
 		Type:    "error",
 		Message: err.Error(),
 	})
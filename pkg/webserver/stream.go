@@ -0,0 +1,154 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brentahughes/service_tester/pkg/models"
+	"github.com/brentahughes/service_tester/pkg/stream"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// streamKeepAlive is how often an idle stream is written to so proxies don't close it
+	streamKeepAlive = 15 * time.Second
+	streamWriteWait = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// getStream pushes new checks, state changes and events as they happen, over a WebSocket
+// when the request is an upgrade and as Server-Sent Events otherwise. Filtered by host,
+// network, type (check type) and kind, a comma separated list of check, state and event.
+func (s *Server) getStream(c *gin.Context) {
+	filter := stream.Filter{
+		HostID:    c.Query("host"),
+		Network:   models.Network(c.Query("network")),
+		CheckType: models.CheckType(c.Query("type")),
+	}
+	if str := c.Query("kind"); str != "" {
+		for _, kind := range strings.Split(str, ",") {
+			switch t := stream.MessageType(kind); t {
+			case stream.MessageCheck, stream.MessageState, stream.MessageEvent:
+				filter.Types = append(filter.Types, t)
+			default:
+				s.writeErr(c, http.StatusBadRequest, fmt.Errorf("invalid kind %q, must be check, state or event", kind))
+				return
+			}
+		}
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		s.streamWebSocket(c, filter)
+		return
+	}
+	s.streamSSE(c, filter)
+}
+
+func (s *Server) streamSSE(c *gin.Context, filter stream.Filter) {
+	sub := s.hub.Subscribe(filter)
+	defer s.hub.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case msg := <-sub.C:
+			if err := writeSSE(c.Writer, msg); err != nil {
+				return
+			}
+		}
+
+		if notice := sub.DroppedNotice(); notice != nil {
+			if err := writeSSE(c.Writer, notice); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// writeSSE writes the message as an event named after its type
+func writeSSE(w io.Writer, msg *stream.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("error marshaling stream message: %v", err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data)
+	return err
+}
+
+func (s *Server) streamWebSocket(c *gin.Context, filter stream.Filter) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader already responded with the error
+		log.Printf("error upgrading stream to websocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	sub := s.hub.Subscribe(filter)
+	defer s.hub.Unsubscribe(sub)
+
+	// Nothing is read from the client, reading only notices when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-closed:
+			return
+		case <-keepAlive.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait))
+		case msg := <-sub.C:
+			err = writeWebSocket(conn, msg)
+		}
+
+		if notice := sub.DroppedNotice(); notice != nil && err == nil {
+			err = writeWebSocket(conn, notice)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeWebSocket(conn *websocket.Conn, msg *stream.Message) error {
+	conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+	return conn.WriteJSON(msg)
+}